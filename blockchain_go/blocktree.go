@@ -0,0 +1,105 @@
+package main
+
+import "sort"
+
+// ReorgEvent is emitted when the canonical chain switches to a heavier
+// branch. Disconnected lists the abandoned blocks tip first, Connected the
+// adopted ones oldest first, which is the order to roll state back and replay
+// it in.
+type ReorgEvent struct {
+	Fork         Block   `json:"fork"` // last block both branches share
+	Disconnected []Block `json:"disconnected"`
+	Connected    []Block `json:"connected"`
+}
+
+// ChainTip is the last block of a branch in the block tree.
+type ChainTip struct {
+	Hash      string `json:"hash"`
+	Height    int    `json:"height"`
+	Work      uint64 `json:"work"`
+	Canonical bool   `json:"canonical"`
+}
+
+type treeNode struct {
+	hash   string
+	index  int
+	parent *treeNode
+	work   uint64 // cumulative work from genesis up to and including this block
+	offset int64  // record offset in the store file
+}
+
+// blockTree indexes every stored block, side chains included. The canonical
+// chain is the path from genesis to the tip with the most cumulative work;
+// on a tie the branch seen first stays canonical.
+type blockTree struct {
+	byHash    map[string]*treeNode
+	tips      map[*treeNode]struct{}
+	canonical []*treeNode // canonical[i] is the canonical block at index i
+}
+
+func newBlockTree() *blockTree {
+	return &blockTree{
+		byHash: make(map[string]*treeNode),
+		tips:   make(map[*treeNode]struct{}),
+	}
+}
+
+func (t *blockTree) best() *treeNode {
+	if len(t.canonical) == 0 {
+		return nil
+	}
+	return t.canonical[len(t.canonical)-1]
+}
+
+func (t *blockTree) add(n *treeNode) {
+	t.byHash[n.hash] = n
+	delete(t.tips, n.parent)
+	t.tips[n] = struct{}{}
+}
+
+func (t *blockTree) isCanonical(n *treeNode) bool {
+	return n.index < len(t.canonical) && t.canonical[n.index] == n
+}
+
+// branch returns the canonical block n's branch forks from, the canonical
+// blocks after it (tip first) and n's branch up to n (oldest first).
+// fork is nil for the genesis block of an empty tree.
+func (t *blockTree) branch(n *treeNode) (fork *treeNode, disconnect, connect []*treeNode) {
+	for fork = n; fork != nil && !t.isCanonical(fork); fork = fork.parent {
+		connect = append(connect, fork)
+	}
+	for i, j := 0, len(connect)-1; i < j; i, j = i+1, j-1 {
+		connect[i], connect[j] = connect[j], connect[i]
+	}
+	for i := len(t.canonical) - 1; fork != nil && i > fork.index; i-- {
+		disconnect = append(disconnect, t.canonical[i])
+	}
+	return fork, disconnect, connect
+}
+
+// setBest makes the path to n the canonical chain.
+func (t *blockTree) setBest(n *treeNode) {
+	fork, _, connect := t.branch(n)
+	keep := 0
+	if fork != nil {
+		keep = fork.index + 1
+	}
+	t.canonical = append(t.canonical[:keep], connect...)
+}
+
+func (t *blockTree) chainTips() []ChainTip {
+	tips := make([]ChainTip, 0, len(t.tips))
+	for n := range t.tips {
+		tips = append(tips, ChainTip{Hash: n.hash, Height: n.index, Work: n.work, Canonical: t.isCanonical(n)})
+	}
+	sort.Slice(tips, func(i, j int) bool {
+		if tips[i].Canonical != tips[j].Canonical {
+			return tips[i].Canonical
+		}
+		if tips[i].Work != tips[j].Work {
+			return tips[i].Work > tips[j].Work
+		}
+		return tips[i].Hash < tips[j].Hash
+	})
+	return tips
+}
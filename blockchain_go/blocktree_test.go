@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// extend seals a block paying the reward to miner on top of parent and
+// appends it to store.
+func extend(t *testing.T, store *blockStore, parent Block, miner string, txs ...Transaction) Block {
+	block := sealBlock(parent, append([]Transaction{NewCoinbase(miner, parent.Index+1, 0)}, txs...))
+	require.NoError(t, store.Append(block))
+	return block
+}
+
+func TestBlockTreeKeepsSideChains(t *testing.T) {
+	store, _ := newTestStore(t, 1)
+	defer store.Close()
+	genesis, _ := store.Tip()
+	alice, bob := testWallet(t), testWallet(t)
+
+	a1 := extend(t, store, genesis, alice.Address())
+	a2 := extend(t, store, a1, alice.Address())
+	b1 := extend(t, store, genesis, bob.Address())
+
+	tip, _ := store.Tip()
+	assert.Equal(t, a2, tip)
+	assert.Equal(t, 3, store.Len())
+	assert.Zero(t, store.UTXO().BalanceOf(bob.Address()))
+
+	side, err := store.BlockByHash(b1.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, b1, side)
+
+	assert.Equal(t, []ChainTip{
+		{Hash: a2.Hash, Height: 2, Work: 1 + 2*16, Canonical: true},
+		{Hash: b1.Hash, Height: 1, Work: 1 + 16},
+	}, store.Tips())
+
+	orphan := sealBlock(Block{Index: 5, Hash: "unknown"}, nil)
+	assert.ErrorIs(t, store.Append(orphan), ErrUnknownParent)
+}
+
+func TestBlockTreeReorgsToHeavierBranch(t *testing.T) {
+	store, path := newTestStore(t, 1)
+	genesis, _ := store.Tip()
+	alice, bob, carol := testWallet(t), testWallet(t), testWallet(t)
+
+	var events []ReorgEvent
+	store.OnReorg(func(ev ReorgEvent) { events = append(events, ev) })
+
+	a1 := extend(t, store, genesis, alice.Address())
+	pay, err := NewTransaction(alice, carol.Address(), 30, store.UTXO())
+	require.NoError(t, err)
+	a2 := extend(t, store, a1, alice.Address(), pay)
+	assert.Equal(t, 30, store.UTXO().BalanceOf(carol.Address()))
+
+	// Bob's branch shares a1 and overtakes Alice's second block.
+	b2 := extend(t, store, a1, bob.Address())
+	assert.Empty(t, events)
+	b3 := extend(t, store, b2, bob.Address())
+
+	require.Len(t, events, 1)
+	assert.Equal(t, a1, events[0].Fork)
+	assert.Equal(t, []Block{a2}, events[0].Disconnected)
+	assert.Equal(t, []Block{b2, b3}, events[0].Connected)
+
+	tip, _ := store.Tip()
+	assert.Equal(t, b3, tip)
+	canonical, err := store.Blocks()
+	require.NoError(t, err)
+	assert.Equal(t, []Block{genesis, a1, b2, b3}, canonical)
+
+	// The payment to Carol was only on the abandoned branch: rolled back.
+	assert.Zero(t, store.UTXO().BalanceOf(carol.Address()))
+	assert.Equal(t, blockReward, store.UTXO().BalanceOf(alice.Address()))
+	assert.Equal(t, 2*blockReward, store.UTXO().BalanceOf(bob.Address()))
+
+	// Alice's output is unspent on this branch, so it can be spent again.
+	extend(t, store, b3, bob.Address(), pay)
+	assert.Equal(t, 30, store.UTXO().BalanceOf(carol.Address()))
+
+	// Reopening replays the log, side chain included, to the same state.
+	want := store.Tips()
+	require.NoError(t, store.Close())
+	store, err = openBlockStore(path, testConsensus)
+	require.NoError(t, err)
+	defer store.Close()
+	assert.Equal(t, want, store.Tips())
+	assert.Equal(t, 30, store.UTXO().BalanceOf(carol.Address()))
+}
+
+func TestBlockTreeRejectsBranchWithBadSpend(t *testing.T) {
+	store, _ := newTestStore(t, 1)
+	defer store.Close()
+	genesis, _ := store.Tip()
+	alice, bob, mallory := testWallet(t), testWallet(t), testWallet(t)
+
+	a1 := extend(t, store, genesis, alice.Address())
+	a2 := extend(t, store, a1, alice.Address())
+
+	// Bob's side branch cannot be checked until it is heavier; then the
+	// theft of Alice's output on a branch where it never existed shows.
+	theft := Transaction{
+		Inputs:    []TxInput{{TxID: a2.Transactions[0].ID(), Vout: 0}},
+		Outputs:   []TxOutput{{Address: mallory.Address(), Amount: blockReward}},
+		PublicKey: mallory.PublicKey,
+	}
+	theft.Signature = mallory.Sign(theft.signingBytes())
+	b1 := extend(t, store, genesis, bob.Address())
+	b2 := extend(t, store, b1, bob.Address(), theft)
+	b3 := sealBlock(b2, []Transaction{NewCoinbase(bob.Address(), 3, 0)})
+	assert.ErrorIs(t, store.Append(b3), ErrUnknownOutput)
+
+	tip, _ := store.Tip()
+	assert.Equal(t, a2, tip)
+	assert.Equal(t, 2*blockReward, store.UTXO().BalanceOf(alice.Address()))
+	assert.Zero(t, store.UTXO().BalanceOf(bob.Address()))
+}
+
+func TestBlockTreeNeverReplacesFinalBlocks(t *testing.T) {
+	store, _ := newTestStore(t, 1)
+	defer store.Close()
+	genesis, _ := store.Tip()
+	alice, bob := testWallet(t), testWallet(t)
+
+	tip := genesis
+	for i := 0; i < powConfirmations+1; i++ {
+		tip = extend(t, store, tip, alice.Address())
+	}
+
+	// Block #1 is final, so a heavier branch forking from genesis is refused.
+	side := genesis
+	for i := 0; i < powConfirmations+1; i++ {
+		side = extend(t, store, side, bob.Address())
+	}
+	heavier := sealBlock(side, []Transaction{NewCoinbase(bob.Address(), side.Index+1, 0)})
+	assert.ErrorIs(t, store.Append(heavier), ErrFinalized)
+
+	current, _ := store.Tip()
+	assert.Equal(t, tip, current)
+}
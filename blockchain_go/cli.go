@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"revisitgo/blockchain_go/wallet"
+)
+
+const (
+	defaultDataDir = "chaindata"
+	configFile     = "chain.json"
+	blocksFile     = "blocks.db"
+	minerKeyFile   = "miner.key"
+	pendingFile    = "pending.json"
+)
+
+var errChainInvalid = errors.New("chain is invalid")
+
+// The chain command scripts a chain kept in a data directory:
+//
+//	chain init   [-data dir] [-consensus pow|poa] [-difficulty n] [-validators keys]
+//	chain add    [-data dir] [-key file] <transaction json> | -to address -amount n
+//	chain mine   [-data dir] [-difficulty n]
+//	chain verify [-data dir]
+//	chain show   [-data dir] <index>
+//	chain export [-data dir] [-format json|csv]
+//
+// Build it with `go build -o chain ./blockchain_go`. Transactions queued with
+// add wait in the data directory until the next mine.
+type command func(args []string, out io.Writer) error
+
+var commands = map[string]command{
+	"init":   initCommand,
+	"add":    addCommand,
+	"mine":   mineCommand,
+	"verify": verifyCommand,
+	"show":   showCommand,
+	"export": exportCommand,
+}
+
+func isCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+func runCommand(args []string, out io.Writer) error {
+	if len(args) == 0 || !isCommand(args[0]) {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("usage: chain <command> [flags], commands: %v", names)
+	}
+	return commands[args[0]](args[1:], out)
+}
+
+// chainConfig is written by init and fixes the consensus of the chain for
+// every later command.
+type chainConfig struct {
+	Consensus  string `json:"consensus"`
+	Difficulty int    `json:"difficulty,omitempty"`
+	Validators string `json:"validators,omitempty"`
+}
+
+type chainDir struct {
+	path   string
+	config chainConfig
+	miner  *wallet.Wallet
+	store  *blockStore
+}
+
+func openChainDir(path string) (*chainDir, error) {
+	data, err := os.ReadFile(filepath.Join(path, configFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s is not a chain directory, run chain init first", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := &chainDir{path: path}
+	if err := json.Unmarshal(data, &d.config); err != nil {
+		return nil, fmt.Errorf("%s: %w", configFile, err)
+	}
+	if d.miner, err = loadWallet(d.file(minerKeyFile)); err != nil {
+		return nil, fmt.Errorf("%s: %w", minerKeyFile, err)
+	}
+	// The miner signs proof of authority blocks only if it is a validator.
+	keyPath := ""
+	if strings.Contains(d.config.Validators, hex.EncodeToString(d.miner.PublicKey)) {
+		keyPath = d.file(minerKeyFile)
+	}
+	engine, err := newConsensus(d.config.Consensus, d.config.Difficulty, d.config.Validators, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if d.store, err = openBlockStore(d.file(blocksFile), engine); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *chainDir) file(name string) string {
+	return filepath.Join(d.path, name)
+}
+
+func (d *chainDir) Close() error {
+	return d.store.Close()
+}
+
+func (d *chainDir) pending() ([]Transaction, error) {
+	data, err := os.ReadFile(d.file(pendingFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var txs []Transaction
+	return txs, json.Unmarshal(data, &txs)
+}
+
+func (d *chainDir) savePending(txs []Transaction) error {
+	if len(txs) == 0 {
+		err := os.Remove(d.file(pendingFile))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.MarshalIndent(txs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.file(pendingFile), data, 0o644)
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	return fs, fs.String("data", defaultDataDir, "chain data directory")
+}
+
+// chain init creates the data directory, a miner key whose address collects
+// the block rewards and the genesis block.
+func initCommand(args []string, out io.Writer) error {
+	fs, dir := newFlagSet("init")
+	consensus := fs.String("consensus", "pow", "consensus engine: pow or poa")
+	difficulty := fs.Int("difficulty", 16, "with pow, minimum leading zero bits of a block hash")
+	validators := fs.String("validators", "", "with poa, comma separated hex public keys in signing order (default: the miner key alone)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(*dir, configFile)); err == nil {
+		return fmt.Errorf("%s already holds a chain", *dir)
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	miner, err := wallet.New()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(*dir, minerKeyFile), []byte(hex.EncodeToString(miner.PrivateKey.Seed())+"\n"), 0o600); err != nil {
+		return err
+	}
+
+	config := chainConfig{Consensus: *consensus}
+	switch *consensus {
+	case "pow":
+		config.Difficulty = *difficulty
+	case "poa":
+		config.Validators = *validators
+		if config.Validators == "" {
+			config.Validators = hex.EncodeToString(miner.PublicKey)
+		}
+	}
+	if _, err := newConsensus(config.Consensus, config.Difficulty, config.Validators, ""); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(*dir, configFile), data, 0o644); err != nil {
+		return err
+	}
+
+	d, err := openChainDir(*dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if _, err := createGenesisBlock(d.store); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "initialised %s chain in %s, miner address %s\n", config.Consensus, *dir, miner.Address())
+	return nil
+}
+
+// chain add queues a transaction for the next block: either a signed
+// transaction given as JSON or a payment from -key built on the spot.
+func addCommand(args []string, out io.Writer) error {
+	fs, dir := newFlagSet("add")
+	keyPath := fs.String("key", "", "wallet seed file paying with -to and -amount (default: the miner key)")
+	to := fs.String("to", "", "address to pay")
+	amount := fs.Int("amount", 0, "amount to pay")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	d, err := openChainDir(*dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	pending, err := d.pending()
+	if err != nil {
+		return err
+	}
+
+	var tx Transaction
+	switch {
+	case fs.NArg() == 1:
+		if err := json.Unmarshal([]byte(fs.Arg(0)), &tx); err != nil {
+			return fmt.Errorf("transaction: %w", err)
+		}
+	case fs.NArg() == 0 && *to != "" && *amount > 0:
+		w := d.miner
+		if *keyPath != "" {
+			if w, err = loadWallet(*keyPath); err != nil {
+				return err
+			}
+		}
+		if tx, err = NewTransaction(w, *to, *amount, d.store.UTXO()); err != nil {
+			return err
+		}
+	default:
+		return errors.New("add takes a transaction as JSON, or -to and a positive -amount")
+	}
+
+	if tx.IsCoinbase() {
+		return errors.New("coinbase transactions cannot be added")
+	}
+	if err := tx.VerifySignature(); err != nil {
+		return err
+	}
+	// Checked together with the queue so two pending transactions cannot
+	// spend the same output.
+	if _, err := d.store.UTXO().Fees(append(pending, tx)); err != nil {
+		return err
+	}
+	if err := d.savePending(append(pending, tx)); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "queued transaction %s (%d pending)\n", tx.ID(), len(pending)+1)
+	return nil
+}
+
+// chain mine seals the queued transactions into a block paying the miner key.
+func mineCommand(args []string, out io.Writer) error {
+	fs, dir := newFlagSet("mine")
+	difficulty := fs.Int("difficulty", 0, "with pow, mine at this many leading zero bits instead of the chain's minimum")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	d, err := openChainDir(*dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	engine := d.store.consensus
+	if *difficulty > 0 {
+		if d.config.Consensus != "pow" {
+			return errors.New("-difficulty only applies to proof of work chains")
+		}
+		if engine, err = NewProofOfWork(*difficulty); err != nil {
+			return err
+		}
+	}
+	pending, err := d.pending()
+	if err != nil {
+		return err
+	}
+	tip, _ := d.store.Tip()
+	block, err := sealAndAppend(d.store, engine, tip, d.miner.Address(), pending)
+	if err != nil {
+		return err
+	}
+	if err := d.savePending(nil); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "mined block #%d %s with %d transactions\n", block.Index, block.Hash, len(block.Transactions))
+	return nil
+}
+
+func verifyCommand(args []string, out io.Writer) error {
+	fs, dir := newFlagSet("verify")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	d, err := openChainDir(*dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	blocks, err := d.store.Blocks()
+	if err != nil {
+		return err
+	}
+	report := ValidateChain(blocks, d.store.consensus)
+	fmt.Fprintln(out, report)
+	if !report.Valid() {
+		return errChainInvalid
+	}
+	return nil
+}
+
+func showCommand(args []string, out io.Writer) error {
+	fs, dir := newFlagSet("show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("show takes a block index")
+	}
+	index, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("block index: %w", err)
+	}
+	d, err := openChainDir(*dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	block, err := d.store.BlockByIndex(index)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(block)
+}
+
+var csvHeader = []string{"index", "hash", "previous_hash", "timestamp", "merkle_root", "transactions", "bits", "nonce", "validator"}
+
+// chain export writes the canonical chain, genesis first. JSON carries every
+// field; CSV has one row per block header.
+func exportCommand(args []string, out io.Writer) error {
+	fs, dir := newFlagSet("export")
+	format := fs.String("format", "json", "json or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown export format %q, want json or csv", *format)
+	}
+	d, err := openChainDir(*dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	blocks, err := d.store.Blocks()
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(blocks)
+	}
+	w := csv.NewWriter(out)
+	w.Write(csvHeader)
+	for _, b := range blocks {
+		w.Write([]string{
+			strconv.Itoa(b.Index),
+			b.Hash,
+			b.PreviousHash,
+			strconv.FormatInt(b.Timestamp, 10),
+			b.MerkleRoot,
+			strconv.Itoa(len(b.Transactions)),
+			strconv.Itoa(int(b.Bits)),
+			strconv.FormatUint(b.Nonce, 10),
+			b.Validator,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
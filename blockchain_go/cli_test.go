@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chain(t *testing.T, args ...string) (string, error) {
+	var out bytes.Buffer
+	err := runCommand(args, &out)
+	return out.String(), err
+}
+
+func TestChainCommands(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	bob := testWallet(t)
+
+	_, err := chain(t, "verify", "-data", dir)
+	assert.ErrorContains(t, err, "run chain init first")
+
+	out, err := chain(t, "init", "-data", dir, "-difficulty", "4")
+	require.NoError(t, err)
+	assert.Contains(t, out, "initialised pow chain")
+	_, err = chain(t, "init", "-data", dir)
+	assert.ErrorContains(t, err, "already holds a chain")
+
+	_, err = chain(t, "mine", "-data", dir)
+	require.NoError(t, err)
+	_, err = chain(t, "add", "-data", dir, "-to", bob.Address(), "-amount", "20")
+	require.NoError(t, err)
+	// The first payment already spends the miner's only output.
+	_, err = chain(t, "add", "-data", dir, "-to", bob.Address(), "-amount", "5")
+	assert.ErrorIs(t, err, ErrDoubleSpend)
+
+	_, err = chain(t, "mine", "-data", dir, "-difficulty", "64")
+	assert.ErrorContains(t, err, "difficulty must be between")
+	out, err = chain(t, "mine", "-data", dir, "-difficulty", "8")
+	require.NoError(t, err)
+	assert.Contains(t, out, "mined block #2")
+	assert.Contains(t, out, "with 2 transactions")
+
+	out, err = chain(t, "verify", "-data", dir)
+	require.NoError(t, err)
+	assert.Contains(t, out, "chain of 3 blocks is valid")
+
+	out, err = chain(t, "show", "-data", dir, "2")
+	require.NoError(t, err)
+	var block Block
+	require.NoError(t, json.Unmarshal([]byte(out), &block))
+	assert.Equal(t, uint8(8), block.Bits)
+	assert.Equal(t, bob.Address(), block.Transactions[1].Outputs[0].Address)
+	_, err = chain(t, "show", "-data", dir, "9")
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+
+	out, err = chain(t, "export", "-data", dir, "-format", "json")
+	require.NoError(t, err)
+	var blocks []Block
+	require.NoError(t, json.Unmarshal([]byte(out), &blocks))
+	assert.Len(t, blocks, 3)
+	assert.Equal(t, block, blocks[2])
+
+	out, err = chain(t, "export", "-data", dir, "-format", "csv")
+	require.NoError(t, err)
+	rows, err := csv.NewReader(bytes.NewBufferString(out)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	assert.Equal(t, csvHeader, rows[0])
+	assert.Equal(t, []string{"2", block.Hash, block.PreviousHash}, rows[3][:3])
+
+	_, err = chain(t, "export", "-data", dir, "-format", "xml")
+	assert.Error(t, err)
+}
+
+func TestChainAddsSignedTransactionJSON(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	_, err := chain(t, "init", "-data", dir, "-consensus", "poa")
+	require.NoError(t, err)
+	_, err = chain(t, "mine", "-data", dir)
+	require.NoError(t, err)
+	_, err = chain(t, "mine", "-data", dir, "-difficulty", "8")
+	assert.ErrorContains(t, err, "proof of work")
+
+	d, err := openChainDir(dir)
+	require.NoError(t, err)
+	tx, err := NewTransaction(d.miner, testWallet(t).Address(), 10, d.store.UTXO())
+	require.NoError(t, err)
+	require.NoError(t, d.Close())
+
+	forged := tx
+	forged.Outputs = append([]TxOutput{}, tx.Outputs...)
+	forged.Outputs[0].Amount = 40
+	data, err := json.Marshal(forged)
+	require.NoError(t, err)
+	_, err = chain(t, "add", "-data", dir, string(data))
+	assert.Error(t, err)
+
+	data, err = json.Marshal(tx)
+	require.NoError(t, err)
+	_, err = chain(t, "add", "-data", dir, string(data))
+	require.NoError(t, err)
+	_, err = chain(t, "mine", "-data", dir)
+	require.NoError(t, err)
+
+	out, err := chain(t, "verify", "-data", dir)
+	require.NoError(t, err)
+	assert.Contains(t, out, "chain of 3 blocks is valid")
+}
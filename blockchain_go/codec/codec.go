@@ -0,0 +1,144 @@
+// Package codec is the canonical binary encoding used for block headers and
+// transactions. Integers are fixed-width big-endian and strings are prefixed
+// with their length, so two different values can never encode to the same
+// bytes.
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrShortBuffer  = errors.New("codec: unexpected end of data")
+	ErrTrailingData = errors.New("codec: trailing data after value")
+)
+
+type Encoder struct {
+	buf []byte
+}
+
+func (e *Encoder) Uint8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *Encoder) Uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *Encoder) Uint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+func (e *Encoder) Int64(v int64) {
+	e.Uint64(uint64(v))
+}
+
+func (e *Encoder) String(s string) {
+	e.Uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// VarBytes writes b with a length prefix, like String.
+func (e *Encoder) VarBytes(b []byte) {
+	e.Uint32(uint32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+// Decoder reads values back in the order they were encoded. The first error
+// sticks: every later read returns a zero value and Err reports it.
+type Decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func NewDecoder(b []byte) *Decoder {
+	return &Decoder{buf: b}
+}
+
+func (d *Decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf)-d.off < n {
+		d.err = ErrShortBuffer
+		return nil
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *Decoder) Uint8() uint8 {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *Decoder) Uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *Decoder) Uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// Count reads a uint32 element count. A count larger than the bytes left
+// cannot be genuine, so it is treated as a short buffer instead of being used
+// to size an allocation.
+func (d *Decoder) Count() int {
+	n := d.Uint32()
+	if d.err == nil && int(n) > len(d.buf)-d.off {
+		d.err = ErrShortBuffer
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (d *Decoder) Int64() int64 {
+	return int64(d.Uint64())
+}
+
+func (d *Decoder) String() string {
+	return string(d.VarBytes())
+}
+
+// VarBytes returns a copy of the next length-prefixed byte slice.
+func (d *Decoder) VarBytes() []byte {
+	b := d.next(d.Count())
+	if len(b) == 0 {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Finish returns the first decoding error, or ErrTrailingData if the input
+// was not consumed completely.
+func (d *Decoder) Finish() error {
+	if d.err != nil {
+		return d.err
+	}
+	if d.off != len(d.buf) {
+		return fmt.Errorf("%w: %d bytes", ErrTrailingData, len(d.buf)-d.off)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"revisitgo/blockchain_go/pow"
+	"revisitgo/blockchain_go/wallet"
+)
+
+// powConfirmations is how many blocks must be mined on top of a proof-of-work
+// block before it is treated as final.
+const powConfirmations = 6
+
+// maxPowBits is the highest difficulty whose work, 1<<bits, fits in a uint64.
+const maxPowBits = 63
+
+// ErrNotInTurn is returned by ProofOfAuthority.Propose when another validator
+// is due to sign the next block.
+var ErrNotInTurn = errors.New("not this validator's turn")
+
+// Consensus decides who may extend the chain and how heavily each block
+// counts when a node chooses between forks. The genesis block is shared by
+// every node and is never sealed.
+type Consensus interface {
+	// Propose seals a fully built block so that peers accept it, setting its
+	// consensus fields and its Hash.
+	Propose(block *Block) error
+	// Validate checks the seal of a block that is not the genesis block.
+	Validate(block Block) error
+	// Finalize returns the index of the last block in chain that can no
+	// longer be replaced by a fork, or -1 for an empty chain.
+	Finalize(chain []Block) int
+	// Work is what block adds to the cumulative work of its chain.
+	Work(block Block) uint64
+}
+
+// ProofOfWork requires every block hash to meet the pow target for the number
+// of zero bits the block's Bits field claims, and Bits to be at least the
+// chain's minimum. Propose mines at the minimum with a parallel pow.Miner.
+// The minimum is fixed rather than retargeted: a block records the bits it
+// was mined at, and fork choice by cumulative work already favours harder
+// blocks. With zero bits any hash is accepted and the chain is a plain hash
+// chain where the longest branch wins.
+type ProofOfWork struct {
+	bits  int
+	miner pow.Miner // the zero value mines with one worker per CPU
+}
+
+func NewProofOfWork(bits int) (*ProofOfWork, error) {
+	if bits < 0 || bits > maxPowBits {
+		return nil, fmt.Errorf("difficulty must be between 0 and %d bits, got %d", maxPowBits, bits)
+	}
+	return &ProofOfWork{bits: bits}, nil
+}
+
+func (p *ProofOfWork) Propose(block *Block) error {
+	block.Bits = uint8(p.bits)
+	nonce, _, err := p.miner.Mine(context.Background(), 0, pow.TargetFromZeroBits(p.bits), func(nonce uint64) [32]byte {
+		candidate := *block
+		candidate.Nonce = nonce
+		return sha256.Sum256(encodeHeader(candidate))
+	})
+	if err != nil {
+		return err
+	}
+	block.Nonce = nonce
+	block.Hash = calculateHash(*block)
+	return nil
+}
+
+func (p *ProofOfWork) Validate(block Block) error {
+	if int(block.Bits) < p.bits {
+		return fmt.Errorf("difficulty is %d bits, below the minimum of %d", block.Bits, p.bits)
+	}
+	if block.Bits > maxPowBits {
+		return fmt.Errorf("difficulty is %d bits, above the maximum of %d", block.Bits, maxPowBits)
+	}
+	hash, err := hex.DecodeString(block.Hash)
+	if err != nil {
+		return fmt.Errorf("hash is not hex: %w", err)
+	}
+	if len(hash) != sha256.Size {
+		return fmt.Errorf("hash is %d bytes, not %d", len(hash), sha256.Size)
+	}
+	if !pow.MeetsTarget(hash, pow.TargetFromZeroBits(int(block.Bits))) {
+		return fmt.Errorf("hash has fewer than %d leading zero bits", block.Bits)
+	}
+	return nil
+}
+
+func (p *ProofOfWork) Finalize(chain []Block) int {
+	if len(chain) == 0 {
+		return -1
+	}
+	return max(0, len(chain)-1-powConfirmations)
+}
+
+// Work is the expected number of hashes it took to find the block.
+func (p *ProofOfWork) Work(block Block) uint64 {
+	return 1 << block.Bits
+}
+
+// ProofOfAuthority lets a fixed set of validators sign blocks in turn: block
+// i must be signed by validator i mod len(validators). A validator that is
+// offline stalls the chain until it comes back.
+type ProofOfAuthority struct {
+	validators []ed25519.PublicKey
+	signer     *wallet.Wallet // nil on a node that only follows the chain
+}
+
+// NewProofOfAuthority returns the engine for the given validator set. signer
+// is the node's own validator key, or nil if it does not sign blocks.
+func NewProofOfAuthority(validators []ed25519.PublicKey, signer *wallet.Wallet) (*ProofOfAuthority, error) {
+	if len(validators) == 0 {
+		return nil, errors.New("proof of authority needs at least one validator")
+	}
+	for i, pub := range validators {
+		if len(pub) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("validator %d: %w", i, wallet.ErrInvalidPublicKey)
+		}
+	}
+	if signer != nil && !containsKey(validators, signer.PublicKey) {
+		return nil, errors.New("signer is not in the validator set")
+	}
+	return &ProofOfAuthority{validators: validators, signer: signer}, nil
+}
+
+// parseValidators reads a comma separated list of hex encoded public keys.
+func parseValidators(list string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		key, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("validator %q: %w", s, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func containsKey(keys []ed25519.PublicKey, key ed25519.PublicKey) bool {
+	for _, k := range keys {
+		if k.Equal(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ProofOfAuthority) inTurn(index int) ed25519.PublicKey {
+	return p.validators[index%len(p.validators)]
+}
+
+func (p *ProofOfAuthority) Propose(block *Block) error {
+	if p.signer == nil || !p.inTurn(block.Index).Equal(p.signer.PublicKey) {
+		return fmt.Errorf("block #%d: %w", block.Index, ErrNotInTurn)
+	}
+	block.Validator = p.signer.Address()
+	block.Hash = calculateHash(*block)
+	block.Seal = p.signer.Sign([]byte(block.Hash))
+	return nil
+}
+
+func (p *ProofOfAuthority) Validate(block Block) error {
+	want := wallet.Address(p.inTurn(block.Index))
+	if block.Validator != want {
+		return fmt.Errorf("signed by %q but it was %q's turn", block.Validator, want)
+	}
+	return wallet.Verify(want, p.inTurn(block.Index), []byte(block.Hash), block.Seal)
+}
+
+// Finalize treats a block as final once a majority of the validators have
+// signed it or a block on top of it.
+func (p *ProofOfAuthority) Finalize(chain []Block) int {
+	if len(chain) == 0 {
+		return -1
+	}
+	return max(0, len(chain)-1-len(p.validators)/2)
+}
+
+func (p *ProofOfAuthority) Work(Block) uint64 {
+	return 1
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"revisitgo/blockchain_go/validation"
+	"revisitgo/blockchain_go/wallet"
+)
+
+func testProofOfWork(t *testing.T, bits int) *ProofOfWork {
+	pow, err := NewProofOfWork(bits)
+	require.NoError(t, err)
+	return pow
+}
+
+func TestProofOfWorkSealsAndValidates(t *testing.T) {
+	pow := testProofOfWork(t, 10)
+	block := Block{Index: 1, Timestamp: 1, MerkleRoot: calculateMerkleRoot(nil)}
+	require.NoError(t, pow.Propose(&block))
+
+	assert.Equal(t, calculateHash(block), block.Hash)
+	assert.Equal(t, "00", block.Hash[:2])
+	assert.NoError(t, pow.Validate(block))
+	assert.Equal(t, uint64(1024), pow.Work(block))
+
+	assert.ErrorContains(t, testProofOfWork(t, 12).Validate(block), "difficulty")
+	assert.NoError(t, testProofOfWork(t, 8).Validate(block), "harder blocks than the minimum are fine")
+
+	block.Hash = "ff" + block.Hash[2:]
+	assert.ErrorContains(t, pow.Validate(block), "leading zero bits")
+
+	block.Hash = "00"
+	assert.ErrorContains(t, pow.Validate(block), "bytes", "a short hash must not pass as all zeros")
+
+	block.Bits = maxPowBits + 1
+	assert.ErrorContains(t, pow.Validate(block), "above the maximum")
+}
+
+func TestProofOfWorkRejectsOutOfRangeDifficulty(t *testing.T) {
+	_, err := NewProofOfWork(-1)
+	assert.Error(t, err)
+	_, err = NewProofOfWork(maxPowBits + 1)
+	assert.Error(t, err)
+	pow := testProofOfWork(t, maxPowBits)
+	assert.Equal(t, uint64(1)<<63, pow.Work(Block{Bits: maxPowBits}))
+}
+
+func TestProofOfWorkFinality(t *testing.T) {
+	pow := testProofOfWork(t, 0)
+	assert.Equal(t, -1, pow.Finalize(nil))
+	assert.Equal(t, 0, pow.Finalize(make([]Block, 3)))
+	assert.Equal(t, 3, pow.Finalize(make([]Block, 4+powConfirmations)))
+}
+
+func testValidators(t *testing.T, n int) ([]*wallet.Wallet, []ed25519.PublicKey) {
+	wallets := make([]*wallet.Wallet, n)
+	keys := make([]ed25519.PublicKey, n)
+	for i := range wallets {
+		wallets[i] = testWallet(t)
+		keys[i] = wallets[i].PublicKey
+	}
+	return wallets, keys
+}
+
+// buildAuthorityChain has the validators take turns sealing n blocks after
+// genesis.
+func buildAuthorityChain(t *testing.T, validators []*wallet.Wallet, keys []ed25519.PublicKey, n int) []Block {
+	genesis := Block{MerkleRoot: calculateMerkleRoot(nil)}
+	genesis.Hash = calculateHash(genesis)
+	chain := []Block{genesis}
+	for i := 1; i <= n; i++ {
+		signer, err := NewProofOfAuthority(keys, validators[i%len(validators)])
+		require.NoError(t, err)
+		prev := chain[i-1]
+		txs := []Transaction{NewCoinbase(validators[i%len(validators)].Address(), i, 0)}
+		block := Block{Index: i, Timestamp: prev.Timestamp + 1, MerkleRoot: calculateMerkleRoot(txs), Transactions: txs, PreviousHash: prev.Hash}
+		require.NoError(t, signer.Propose(&block))
+		chain = append(chain, block)
+	}
+	return chain
+}
+
+func TestProofOfAuthorityValidatorsTakeTurns(t *testing.T) {
+	validators, keys := testValidators(t, 3)
+	chain := buildAuthorityChain(t, validators, keys, 4)
+
+	follower, err := NewProofOfAuthority(keys, nil)
+	require.NoError(t, err)
+	report := ValidateChain(chain, follower)
+	assert.True(t, report.Valid(), report.String())
+	assert.Equal(t, validators[1].Address(), chain[1].Validator)
+	assert.Equal(t, validators[0].Address(), chain[3].Validator)
+
+	// Validator 0 may not seal block 5, which is validator 2's.
+	first, err := NewProofOfAuthority(keys, validators[0])
+	require.NoError(t, err)
+	next := Block{Index: 5, PreviousHash: chain[4].Hash}
+	assert.ErrorIs(t, first.Propose(&next), ErrNotInTurn)
+	assert.ErrorIs(t, follower.Propose(&next), ErrNotInTurn)
+}
+
+func TestProofOfAuthorityRejectsBadSeals(t *testing.T) {
+	validators, keys := testValidators(t, 2)
+	follower, err := NewProofOfAuthority(keys, nil)
+	require.NoError(t, err)
+
+	// Out of turn: validator 0 signs block 1 as if it were its own.
+	chain := buildAuthorityChain(t, validators, keys, 2)
+	chain[1].Validator = validators[0].Address()
+	chain[1].Hash = calculateHash(chain[1])
+	chain[1].Seal = validators[0].Sign([]byte(chain[1].Hash))
+	chain[2].PreviousHash = chain[1].Hash
+	chain[2].Hash = calculateHash(chain[2])
+	chain[2].Seal = validators[0].Sign([]byte(chain[2].Hash))
+
+	report := ValidateChain(chain, follower)
+	assert.Equal(t, []validation.LinkError{
+		{Position: 1, Check: CheckSeal, Expected: "block sealed by the chain's consensus", Actual: `signed by "` + validators[0].Address() + `" but it was "` + validators[1].Address() + `"'s turn`},
+	}, report.Errors)
+
+	// An outsider cannot seal a block even under the right validator's name.
+	chain = buildAuthorityChain(t, validators, keys, 1)
+	outsider := testWallet(t)
+	chain[1].Seal = outsider.Sign([]byte(chain[1].Hash))
+	report = ValidateChain(chain, follower)
+	require.Len(t, report.Errors, 1)
+	assert.Equal(t, CheckSeal, report.Errors[0].Check)
+
+	_, err = NewProofOfAuthority(keys, outsider)
+	assert.Error(t, err)
+}
+
+func TestProofOfAuthorityFinality(t *testing.T) {
+	_, keys := testValidators(t, 4)
+	poa, err := NewProofOfAuthority(keys, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, poa.Finalize(make([]Block, 2)))
+	assert.Equal(t, 7, poa.Finalize(make([]Block, 10)))
+	assert.Equal(t, uint64(1), poa.Work(Block{}))
+}
+
+func TestStoreRejectsChainSealedByAnotherConsensus(t *testing.T) {
+	store, path := newTestStore(t, 3)
+	require.NoError(t, store.Close())
+
+	_, keys := testValidators(t, 1)
+	poa, err := NewProofOfAuthority(keys, nil)
+	require.NoError(t, err)
+	_, err = openBlockStore(path, poa)
+	assert.ErrorIs(t, err, ErrInvalidChain)
+}
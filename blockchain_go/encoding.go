@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+
+	"revisitgo/blockchain_go/codec"
+)
+
+// blockEncodingVersion is written first in every encoded header. Bump it
+// whenever a field is added, removed or reordered.
+const blockEncodingVersion = 4
+
+// encodeHeader returns the canonical header bytes that calculateHash commits
+// to: version, index, Unix-nano timestamp, previous hash, Merkle root and the
+// consensus fields. The proof of authority seal signs the hash and so is only
+// part of the storage encoding.
+func encodeHeader(block Block) []byte {
+	var e codec.Encoder
+	writeHeader(&e, block)
+	return e.Bytes()
+}
+
+func writeHeader(e *codec.Encoder, block Block) {
+	e.Uint8(blockEncodingVersion)
+	e.Uint64(uint64(block.Index))
+	e.Int64(block.Timestamp)
+	e.String(block.PreviousHash)
+	e.String(block.MerkleRoot)
+	e.Uint8(block.Bits)
+	e.Uint64(block.Nonce)
+	e.String(block.Validator)
+}
+
+func readHeader(d *codec.Decoder) (Block, error) {
+	if v := d.Uint8(); d.Err() == nil && v != blockEncodingVersion {
+		return Block{}, fmt.Errorf("unsupported block encoding version %d", v)
+	}
+	return Block{
+		Index:        int(d.Uint64()),
+		Timestamp:    d.Int64(),
+		PreviousHash: d.String(),
+		MerkleRoot:   d.String(),
+		Bits:         d.Uint8(),
+		Nonce:        d.Uint64(),
+		Validator:    d.String(),
+	}, d.Err()
+}
+
+// writeUnsignedTransaction writes everything the sender signs.
+func writeUnsignedTransaction(e *codec.Encoder, tx Transaction) {
+	e.Uint32(uint32(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		e.String(in.TxID)
+		e.Uint32(uint32(in.Vout))
+	}
+	e.Uint32(uint32(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		e.String(out.Address)
+		e.Int64(int64(out.Amount))
+	}
+	e.VarBytes(tx.PublicKey)
+}
+
+func writeTransaction(e *codec.Encoder, tx Transaction) {
+	writeUnsignedTransaction(e, tx)
+	e.VarBytes(tx.Signature)
+}
+
+func readTransaction(d *codec.Decoder) Transaction {
+	var tx Transaction
+	if n := d.Count(); n > 0 {
+		tx.Inputs = make([]TxInput, n)
+		for i := range tx.Inputs {
+			tx.Inputs[i] = TxInput{TxID: d.String(), Vout: int(d.Uint32())}
+		}
+	}
+	if n := d.Count(); n > 0 {
+		tx.Outputs = make([]TxOutput, n)
+		for i := range tx.Outputs {
+			tx.Outputs[i] = TxOutput{Address: d.String(), Amount: int(d.Int64())}
+		}
+	}
+	tx.PublicKey = d.VarBytes()
+	tx.Signature = d.VarBytes()
+	return tx
+}
+
+// encodeBlock is the storage encoding: the header followed by the block hash,
+// the seal and the transactions.
+func encodeBlock(block Block) []byte {
+	var e codec.Encoder
+	writeHeader(&e, block)
+	e.String(block.Hash)
+	e.VarBytes(block.Seal)
+	e.Uint32(uint32(len(block.Transactions)))
+	for _, tx := range block.Transactions {
+		writeTransaction(&e, tx)
+	}
+	return e.Bytes()
+}
+
+func decodeBlock(b []byte) (Block, error) {
+	d := codec.NewDecoder(b)
+	block, err := readHeader(d)
+	if err != nil {
+		return Block{}, err
+	}
+	block.Hash = d.String()
+	block.Seal = d.VarBytes()
+	if n := d.Count(); n > 0 {
+		block.Transactions = make([]Transaction, n)
+		for i := range block.Transactions {
+			block.Transactions[i] = readTransaction(d)
+		}
+	}
+	return block, d.Finish()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func goldenBlock() Block {
+	txs := []Transaction{{
+		Inputs:    []TxInput{{TxID: "aa", Vout: 1}},
+		Outputs:   []TxOutput{{Address: "bob", Amount: 5}},
+		PublicKey: []byte{1, 2},
+		Signature: []byte{3},
+	}}
+	return Block{
+		Index:        1,
+		Timestamp:    1700000000000000000,
+		PreviousHash: "ab",
+		MerkleRoot:   "cd",
+		Transactions: txs,
+		Hash:         "ef",
+		Bits:         8,
+		Nonce:        42,
+		Validator:    "v",
+		Seal:         []byte{9},
+	}
+}
+
+// The golden vectors pin the encoding. If they change, every stored block and
+// every hash in existing chains changes with them, so bump
+// blockEncodingVersion instead of updating the vectors.
+func TestEncodeHeaderGolden(t *testing.T) {
+	block := goldenBlock()
+	assert.Equal(t, "04000000000000000117979cfe362a000000000002616200000002636408000000000000002a0000000176", hex.EncodeToString(encodeHeader(block)))
+	assert.Equal(t, "b7ba8c28c1b06d6465a78ffd17c4945ea9a551fc956399f32144ca70782386cd", calculateHash(block))
+}
+
+func TestEncodeTransactionGolden(t *testing.T) {
+	tx := goldenBlock().Transactions[0]
+	assert.Equal(t, "00000001000000026161000000010000000100000003626f6200000000000000050000000201020000000103", hex.EncodeToString(tx.serialize()))
+}
+
+func TestEncodeHeaderIsUnambiguous(t *testing.T) {
+	a := Block{Index: 1, PreviousHash: "23"}
+	b := Block{Index: 12, PreviousHash: "3"}
+	assert.NotEqual(t, calculateHash(a), calculateHash(b))
+
+	c := Block{PreviousHash: "ab", MerkleRoot: "c"}
+	d := Block{PreviousHash: "a", MerkleRoot: "bc"}
+	assert.NotEqual(t, calculateHash(c), calculateHash(d))
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	block := goldenBlock()
+	decoded, err := decodeBlock(encodeBlock(block))
+	require.NoError(t, err)
+	assert.Equal(t, block, decoded)
+
+	encoded := encodeBlock(block)
+	_, err = decodeBlock(encoded[:len(encoded)-1])
+	assert.Error(t, err)
+	_, err = decodeBlock(append(encoded, 0))
+	assert.Error(t, err)
+
+	encoded[0] = blockEncodingVersion + 1
+	_, err = decodeBlock(encoded)
+	assert.ErrorContains(t, err, "version")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"revisitgo/blockchain_go/validation"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// blockMiner appends a block holding txs. A Node also gossips it to peers.
+type blockMiner interface {
+	MineBlock(miner string, txs []Transaction) (Block, error)
+}
+
+// localMiner appends straight to the store when no node is running.
+type localMiner struct {
+	mu    sync.Mutex
+	store *blockStore
+}
+
+func (m *localMiner) MineBlock(miner string, txs []Transaction) (Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tip, ok := m.store.Tip()
+	if !ok {
+		return Block{}, errors.New("chain has no genesis block")
+	}
+	return genesisBlock(m.store, tip, miner, txs)
+}
+
+// explorer serves the chain as JSON. Submitted transactions are mined right
+// away into a block whose reward goes to minerAddress.
+type explorer struct {
+	store        *blockStore
+	miner        blockMiner
+	minerAddress string
+}
+
+type blockPage struct {
+	Blocks []Block `json:"blocks"`
+	Page   int     `json:"page"`
+	Limit  int     `json:"limit"`
+	Total  int     `json:"total"`
+}
+
+type validateResponse struct {
+	Valid bool `json:"valid"`
+	validation.ChainReport
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (e *explorer) router() *mux.Router {
+	r := mux.NewRouter()
+
+	r.HandleFunc("/blocks", e.listBlocksHandler).Methods("GET")
+	r.HandleFunc("/blocks/{index:[0-9]+}", e.blockByIndexHandler).Methods("GET")
+	r.HandleFunc("/blocks/hash/{hash:[0-9a-f]+}", e.blockByHashHandler).Methods("GET")
+	r.HandleFunc("/transactions", e.submitTransactionHandler).Methods("POST")
+	r.HandleFunc("/validate", e.validateHandler).Methods("GET")
+	r.HandleFunc("/tips", e.tipsHandler).Methods("GET")
+
+	return r
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// queryInt reads a positive integer query parameter, falling back to def.
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, errors.New(name + " must be a positive integer")
+	}
+	return n, nil
+}
+
+// Handler for GET /blocks?page=1&limit=20, oldest block first
+func (e *explorer) listBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := queryInt(r, "page", 1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit = min(limit, maxPageSize)
+
+	total := e.store.Len()
+	resp := blockPage{Blocks: []Block{}, Page: page, Limit: limit, Total: total}
+	// Past the last page, without computing (page-1)*limit, which can overflow.
+	start := total
+	if page-1 <= total/limit {
+		start = min((page-1)*limit, total)
+	}
+	for i := start; i < total && len(resp.Blocks) < limit; i++ {
+		block, err := e.store.BlockByIndex(i)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		resp.Blocks = append(resp.Blocks, block)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Handler for GET /blocks/{index}
+func (e *explorer) blockByIndexHandler(w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.Atoi(mux.Vars(r)["index"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	e.writeBlock(w, func() (Block, error) { return e.store.BlockByIndex(index) })
+}
+
+// Handler for GET /blocks/hash/{hash}
+func (e *explorer) blockByHashHandler(w http.ResponseWriter, r *http.Request) {
+	hash := mux.Vars(r)["hash"]
+	e.writeBlock(w, func() (Block, error) { return e.store.BlockByHash(hash) })
+}
+
+func (e *explorer) writeBlock(w http.ResponseWriter, lookup func() (Block, error)) {
+	block, err := lookup()
+	switch {
+	case errors.Is(err, ErrBlockNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, block)
+	}
+}
+
+// Handler for POST /transactions. The body is a signed Transaction.
+func (e *explorer) submitTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	var tx Transaction
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&tx); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if tx.IsCoinbase() {
+		writeError(w, http.StatusBadRequest, errors.New("coinbase transactions cannot be submitted"))
+		return
+	}
+	if err := tx.VerifySignature(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	block, err := e.miner.MineBlock(e.minerAddress, []Transaction{tx})
+	if err != nil {
+		// The chain rejected the spend: unknown output, double spend, ...
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, block)
+}
+
+// Handler for GET /validate
+func (e *explorer) validateHandler(w http.ResponseWriter, r *http.Request) {
+	blocks, err := e.store.Blocks()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	report := ValidateChain(blocks, e.store.consensus)
+	writeJSON(w, http.StatusOK, validateResponse{Valid: report.Valid(), ChainReport: report})
+}
+
+// Handler for GET /tips, one entry per known branch with its cumulative work
+func (e *explorer) tipsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, e.store.Tips())
+}
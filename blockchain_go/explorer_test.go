@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExplorer(t *testing.T, blocks int) (*explorer, http.Handler) {
+	store, _ := newTestStore(t, blocks)
+	t.Cleanup(func() { store.Close() })
+	e := &explorer{store: store, miner: &localMiner{store: store}, minerAddress: testWallet(t).Address()}
+	return e, e.router()
+}
+
+func doRequest(t *testing.T, h http.Handler, method, path string, body any, out any) int {
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, &buf))
+	if out != nil {
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(out))
+	}
+	return rec.Code
+}
+
+func TestExplorerListsBlocksWithPagination(t *testing.T) {
+	_, h := newTestExplorer(t, 5)
+
+	var page blockPage
+	assert.Equal(t, http.StatusOK, doRequest(t, h, "GET", "/blocks?page=2&limit=2", nil, &page))
+	assert.Equal(t, 5, page.Total)
+	require.Len(t, page.Blocks, 2)
+	assert.Equal(t, 2, page.Blocks[0].Index)
+	assert.Equal(t, 3, page.Blocks[1].Index)
+
+	assert.Equal(t, http.StatusOK, doRequest(t, h, "GET", "/blocks?page=9", nil, &page))
+	assert.Empty(t, page.Blocks)
+	assert.Equal(t, http.StatusOK, doRequest(t, h, "GET", "/blocks?page=9223372036854775807&limit=100", nil, &page))
+	assert.Empty(t, page.Blocks)
+
+	var errResp errorResponse
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, "GET", "/blocks?limit=0", nil, &errResp))
+}
+
+func TestExplorerLooksUpBlocks(t *testing.T) {
+	e, h := newTestExplorer(t, 3)
+	want, err := e.store.BlockByIndex(2)
+	require.NoError(t, err)
+
+	var block Block
+	assert.Equal(t, http.StatusOK, doRequest(t, h, "GET", "/blocks/2", nil, &block))
+	assert.Equal(t, want, block)
+
+	block = Block{}
+	assert.Equal(t, http.StatusOK, doRequest(t, h, "GET", "/blocks/hash/"+want.Hash, nil, &block))
+	assert.Equal(t, want, block)
+
+	var errResp errorResponse
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, "GET", "/blocks/42", nil, &errResp))
+	assert.Equal(t, ErrBlockNotFound.Error(), errResp.Error)
+}
+
+func TestExplorerAcceptsTransactions(t *testing.T) {
+	e, h := newTestExplorer(t, 1)
+	alice, bob := testWallet(t), testWallet(t)
+	_, err := e.miner.MineBlock(alice.Address(), nil)
+	require.NoError(t, err)
+
+	tx, err := NewTransaction(alice, bob.Address(), 20, e.store.UTXO())
+	require.NoError(t, err)
+
+	var block Block
+	assert.Equal(t, http.StatusCreated, doRequest(t, h, "POST", "/transactions", tx, &block))
+	assert.Equal(t, 2, block.Index)
+	assert.Equal(t, 20, e.store.UTXO().BalanceOf(bob.Address()))
+
+	var errResp errorResponse
+	assert.Equal(t, http.StatusUnprocessableEntity, doRequest(t, h, "POST", "/transactions", tx, &errResp))
+	assert.Contains(t, errResp.Error, ErrDoubleSpend.Error())
+
+	tx.Outputs[0].Amount = 45
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, "POST", "/transactions", tx, &errResp))
+}
+
+func TestExplorerValidate(t *testing.T) {
+	_, h := newTestExplorer(t, 3)
+
+	var resp validateResponse
+	assert.Equal(t, http.StatusOK, doRequest(t, h, "GET", "/validate", nil, &resp))
+	assert.True(t, resp.Valid)
+	assert.Equal(t, 3, resp.Length)
+	assert.Equal(t, -1, resp.FirstInvalid)
+}
+
+func TestExplorerListsBranchTips(t *testing.T) {
+	e, h := newTestExplorer(t, 2)
+	genesis, err := e.store.BlockByIndex(0)
+	require.NoError(t, err)
+	side := extend(t, e.store, genesis, testWallet(t).Address())
+
+	var tips []ChainTip
+	assert.Equal(t, http.StatusOK, doRequest(t, h, "GET", "/tips", nil, &tips))
+	require.Len(t, tips, 2)
+	assert.True(t, tips[0].Canonical)
+	assert.Equal(t, ChainTip{Hash: side.Hash, Height: 1, Work: tips[0].Work}, tips[1])
+}
@@ -1,83 +1,306 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
 	"time"
+
+	"revisitgo/blockchain_go/wallet"
 )
 
+const storePath = "blockchain.db"
+
 type Block struct {
-	Index        int
-	PreviousHash string
-	Hash         string
-	Timestamp    string
-	Data         string
+	Index        int           `json:"index"`
+	PreviousHash string        `json:"previous_hash"`
+	Hash         string        `json:"hash"`
+	Timestamp    int64         `json:"timestamp"` // Unix nanoseconds
+	MerkleRoot   string        `json:"merkle_root"`
+	Transactions []Transaction `json:"transactions"`
+
+	// Consensus fields, filled in by Consensus.Propose.
+	Bits      uint8  `json:"bits,omitempty"`      // proof of work difficulty
+	Nonce     uint64 `json:"nonce,omitempty"`     // proof of work solution
+	Validator string `json:"validator,omitempty"` // address of the proof of authority signer
+	Seal      []byte `json:"seal,omitempty"`      // validator's signature of Hash
 }
 
 func calculateHash(block Block) string {
-	record := fmt.Sprintf("%d%s%s%s", block.Index, block.Timestamp, block.Data, block.PreviousHash)
-	h := sha256.New()
-	h.Write([]byte(record))
-	return hex.EncodeToString(h.Sum(nil))
+	sum := sha256.Sum256(encodeHeader(block))
+	return hex.EncodeToString(sum[:])
 }
 
-func createGenesisBlock() Block {
+// genesisTimestamp is fixed so that every node builds the same genesis block
+// and their chains can be compared.
+const genesisTimestamp = 1700000000000000000
+
+func createGenesisBlock(store *blockStore) (Block, error) {
 	genesis := Block{
 		Index:        0,
-		Timestamp:    time.Now().String(),
-		Data:         "This is genesis block first",
+		Timestamp:    genesisTimestamp,
+		MerkleRoot:   calculateMerkleRoot(nil),
 		PreviousHash: "",
 	}
 	genesis.Hash = calculateHash(genesis)
-	return genesis
+	return genesis, store.Append(genesis)
 }
 
-func genesisBlock(prevBlock Block, data string) Block {
+// genesisBlock builds the block after prevBlock, paying the block reward and
+// the fees of txs to miner, seals it with the store's consensus and appends it
+// to store.
+func genesisBlock(store *blockStore, prevBlock Block, miner string, txs []Transaction) (Block, error) {
+	return sealAndAppend(store, store.consensus, prevBlock, miner, txs)
+}
+
+// sealAndAppend is genesisBlock with the block sealed by engine instead, e.g.
+// to mine above the chain's minimum difficulty.
+func sealAndAppend(store *blockStore, engine Consensus, prevBlock Block, miner string, txs []Transaction) (Block, error) {
+	fees, err := store.UTXO().Fees(txs)
+	if err != nil {
+		return Block{}, err
+	}
+	txs = append([]Transaction{NewCoinbase(miner, prevBlock.Index+1, fees)}, txs...)
 	newBlock := Block{
 		Index:        prevBlock.Index + 1,
-		Timestamp:    time.Now().String(),
-		Data:         data,
+		Timestamp:    time.Now().UnixNano(),
+		MerkleRoot:   calculateMerkleRoot(txs),
+		Transactions: txs,
 		PreviousHash: prevBlock.Hash,
 	}
-	newBlock.Hash = calculateHash(newBlock)
-	return newBlock
+	if err := engine.Propose(&newBlock); err != nil {
+		return Block{}, err
+	}
+	return newBlock, store.Append(newBlock)
+}
+
+func isBlockValid(engine Consensus, prev, curr Block) bool {
+	return len(linkErrors(engine, prev, curr)) == 0
+}
+
+// newConsensus builds the engine selected on the command line. keyPath names
+// a file holding this node's hex encoded validator seed.
+func newConsensus(name string, difficulty int, validators, keyPath string) (Consensus, error) {
+	switch name {
+	case "pow":
+		return NewProofOfWork(difficulty)
+	case "poa":
+		keys, err := parseValidators(validators)
+		if err != nil {
+			return nil, err
+		}
+		var signer *wallet.Wallet
+		if keyPath != "" {
+			if signer, err = loadWallet(keyPath); err != nil {
+				return nil, fmt.Errorf("validator key: %w", err)
+			}
+		}
+		return NewProofOfAuthority(keys, signer)
+	default:
+		return nil, fmt.Errorf("unknown consensus %q, want pow or poa", name)
+	}
 }
 
-func isBlockValid(prev, curr Block) bool {
-	if curr.Index != prev.Index+1 {
-		return false
-	} else if curr.PreviousHash != prev.Hash {
-		return false
-	} else if curr.Hash != calculateHash(curr) {
-		return false
+// loadWallet reads a hex encoded wallet seed from path.
+func loadWallet(path string) (*wallet.Wallet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	return wallet.FromSeed(seed)
+}
+
+func newWallet() *wallet.Wallet {
+	w, err := wallet.New()
+	if err != nil {
+		log.Fatal("Error creating wallet:", err)
+	}
+	return w
+}
+
+// runServer runs until interrupted: a network node when listen is set, the
+// HTTP explorer when httpAddr is set, and a block every mineEvery if non-zero.
+func runServer(store *blockStore, listen, advertise, httpAddr, peers string, mineEvery time.Duration) {
+	var miner blockMiner = &localMiner{store: store}
+	if listen != "" {
+		node, err := NewNode(store, listen, advertise)
+		if err != nil {
+			log.Fatal("Error starting node:", err)
+		}
+		defer node.Close()
+		for _, peer := range strings.Split(peers, ",") {
+			if peer != "" {
+				node.AddPeer(peer)
+			}
+		}
+		if err := node.Sync(); err != nil {
+			log.Println("Initial sync:", err)
+		}
+		fmt.Printf("Node listening on %s at height %d\n", node.Addr(), node.Height())
+		miner = node
+	}
+
+	minerWallet := newWallet()
+	if httpAddr != "" {
+		api := &explorer{store: store, miner: miner, minerAddress: minerWallet.Address()}
+		server := &http.Server{Addr: httpAddr, Handler: api.router()}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Println("Error starting the explorer:", err)
+			}
+		}()
+		defer server.Shutdown(context.Background())
+		fmt.Printf("Explorer is running on http://%s/\n", httpAddr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var tick <-chan time.Time
+	if mineEvery > 0 {
+		ticker := time.NewTicker(mineEvery)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			block, err := miner.MineBlock(minerWallet.Address(), nil)
+			if errors.Is(err, ErrNotInTurn) {
+				continue
+			}
+			if err != nil {
+				log.Println("Error mining block:", err)
+				continue
+			}
+			fmt.Printf("Mined block #%d %s\n", block.Index, block.Hash)
+		}
 	}
-	return true
 }
 
 func main() {
-	blockChain := []Block{createGenesisBlock()}
+	if len(os.Args) > 1 && isCommand(os.Args[1]) {
+		if err := runCommand(os.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "chain:", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	blockChain = append(blockChain, genesisBlock(blockChain[len(blockChain)-1], "this is second block"))
-	blockChain = append(blockChain, genesisBlock(blockChain[len(blockChain)-1], "this is third block"))
+	listen := flag.String("listen", "", "run as a network node on this address, e.g. :3000")
+	advertise := flag.String("advertise", "", "with -listen, the address peers reach this node on (default: the listen address, localhost if no host is given)")
+	peers := flag.String("peers", "", "comma separated addresses of peers to sync with")
+	httpAddr := flag.String("http", "", "serve the JSON explorer on this address, e.g. :8080")
+	mineEvery := flag.Duration("mine", 0, "with -listen or -http, mine a block at this interval")
+	dataPath := flag.String("data", storePath, "block store file")
+	consensusName := flag.String("consensus", "pow", "consensus engine: pow or poa")
+	difficulty := flag.Int("difficulty", 16, "with -consensus pow, leading zero bits every block hash needs")
+	validators := flag.String("validators", "", "with -consensus poa, comma separated hex public keys of the validators in signing order")
+	keyPath := flag.String("key", "", "with -consensus poa, file holding this node's hex validator seed")
+	keygen := flag.Bool("keygen", false, "print a new validator seed and public key and exit")
+	flag.Parse()
+
+	if *keygen {
+		w := newWallet()
+		fmt.Printf("seed       : %x\npublic key : %x\naddress    : %s\n", w.PrivateKey.Seed(), w.PublicKey, w.Address())
+		return
+	}
+
+	engine, err := newConsensus(*consensusName, *difficulty, *validators, *keyPath)
+	if err != nil {
+		log.Fatal("Error setting up consensus:", err)
+	}
+	store, err := openBlockStore(*dataPath, engine)
+	if err != nil {
+		log.Fatal("Error opening block store:", err)
+	}
+	defer store.Close()
+
+	if store.Len() == 0 {
+		if _, err := createGenesisBlock(store); err != nil {
+			log.Fatal("Error creating genesis block:", err)
+		}
+	}
+
+	if *listen != "" || *httpAddr != "" {
+		runServer(store, *listen, *advertise, *httpAddr, *peers, *mineEvery)
+		return
+	}
+
+	alice, bob, carol := newWallet(), newWallet(), newWallet()
+
+	tip, _ := store.Tip()
+	tip, err = genesisBlock(store, tip, alice.Address(), nil)
+	if err != nil {
+		log.Fatal("Error appending block:", err)
+	}
+
+	toCarol, err := NewTransaction(alice, carol.Address(), 20, store.UTXO())
+	if err != nil {
+		log.Fatal("Error creating transaction:", err)
+	}
+	// Built from the same unspent output as toCarol, so only one can be mined.
+	toBob, err := NewTransaction(alice, bob.Address(), 10, store.UTXO())
+	if err != nil {
+		log.Fatal("Error creating transaction:", err)
+	}
+
+	tip, err = genesisBlock(store, tip, bob.Address(), []Transaction{toCarol})
+	if err != nil {
+		log.Fatal("Error appending block:", err)
+	}
+	_, err = genesisBlock(store, tip, bob.Address(), []Transaction{toBob})
+	fmt.Println("double spend rejected ? ", errors.Is(err, ErrDoubleSpend), err)
+
+	for name, w := range map[string]*wallet.Wallet{"alice": alice, "bob": bob, "carol": carol} {
+		fmt.Printf("balance of %-5s: %d\n", name, store.UTXO().BalanceOf(w.Address()))
+	}
+
+	blockChain, err := store.Blocks()
+	if err != nil {
+		log.Fatal("Error reading blocks:", err)
+	}
 
 	for i := 1; i < len(blockChain); i++ {
 		fmt.Printf("\n--- Block #%d ---\n", blockChain[i].Index)
-		fmt.Println("Timestamp   :", blockChain[i].Timestamp)
-		fmt.Println("Data        :", blockChain[i].Data)
+		fmt.Println("Timestamp   :", time.Unix(0, blockChain[i].Timestamp))
+		fmt.Println("Merkle Root :", blockChain[i].MerkleRoot)
+		fmt.Println("Transactions:", blockChain[i].Transactions)
 		fmt.Println("Prev. Hash  :", blockChain[i].PreviousHash)
 		fmt.Println("Hash        :", blockChain[i].Hash)
-		fmt.Println("is blockchain valid ? ", isBlockValid(blockChain[i-1], blockChain[i]))
+		fmt.Println("is blockchain valid ? ", isBlockValid(store.consensus, blockChain[i-1], blockChain[i]))
 	}
 
-	blockChain[2].Data = "data is tampered"
+	last := &blockChain[len(blockChain)-1]
+	proof, _ := TransactionProof(*last, 1)
+	fmt.Println("\nlight client sees tx 1 in last block ? ", VerifyTransaction(last.MerkleRoot, last.Transactions[1], proof))
+
+	last.Transactions[1].Outputs[0].Amount = 100
 
 	for i := 1; i < len(blockChain); i++ {
 		fmt.Printf("\n--- Block #%d ---\n", blockChain[i].Index)
-		fmt.Println("Timestamp   :", blockChain[i].Timestamp)
-		fmt.Println("Data        :", blockChain[i].Data)
+		fmt.Println("Timestamp   :", time.Unix(0, blockChain[i].Timestamp))
+		fmt.Println("Merkle Root :", blockChain[i].MerkleRoot)
+		fmt.Println("Transactions:", blockChain[i].Transactions)
 		fmt.Println("Prev. Hash  :", blockChain[i].PreviousHash)
 		fmt.Println("Hash        :", blockChain[i].Hash)
-		fmt.Println("is blockchain valid ? ", isBlockValid(blockChain[i-1], blockChain[i]))
+		fmt.Println("is blockchain valid ? ", isBlockValid(store.consensus, blockChain[i-1], blockChain[i]))
 	}
+
+	fmt.Println()
+	fmt.Println(ValidateChain(blockChain, store.consensus))
 }
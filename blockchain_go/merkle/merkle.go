@@ -0,0 +1,135 @@
+// Package merkle builds binary Merkle trees over transaction hashes and
+// produces inclusion proofs that can be checked against the root alone.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// Leaves and inner nodes are hashed with different prefixes so an inner node
+// can never be passed off as a leaf (second pre-image attack).
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+var ErrIndexOutOfRange = errors.New("merkle: leaf index out of range")
+
+// Tree keeps every level of the tree, leaves first, so proofs can be read off
+// without rehashing.
+type Tree struct {
+	levels [][][]byte
+}
+
+// Step is one sibling on the path from a leaf to the root. Left reports
+// whether the sibling sits to the left of the running hash.
+type Step struct {
+	Hash []byte
+	Left bool
+}
+
+type Proof []Step
+
+// New builds a tree over the given leaf data. When a level has an odd number
+// of nodes the last one is promoted unchanged instead of being duplicated.
+func New(leaves [][]byte) *Tree {
+	level := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = hashLeaf(leaf)
+	}
+	t := &Tree{levels: [][][]byte{level}}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, hashNode(level[i], level[i+1]))
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t
+}
+
+// Build builds a tree whose leaves are items in their encode form.
+func Build[T any](items []T, encode func(T) []byte) *Tree {
+	leaves := make([][]byte, len(items))
+	for i, item := range items {
+		leaves[i] = encode(item)
+	}
+	return New(leaves)
+}
+
+// Root returns the tree root. An empty tree has the hash of no data as root.
+func (t *Tree) Root() []byte {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	}
+	return top[0]
+}
+
+// RootHex returns the tree root hex encoded, as block headers carry it.
+func (t *Tree) RootHex() string {
+	return hex.EncodeToString(t.Root())
+}
+
+// Proof returns the sibling path for the leaf at index.
+func (t *Tree) Proof(index int) (Proof, error) {
+	if index < 0 || index >= len(t.levels[0]) {
+		return nil, ErrIndexOutOfRange
+	}
+	var proof Proof
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, Step{Hash: level[sibling], Left: sibling < index})
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// Verify reports whether leaf is included under root according to proof.
+func Verify(root, leaf []byte, proof Proof) bool {
+	hash := hashLeaf(leaf)
+	for _, step := range proof {
+		if step.Left {
+			hash = hashNode(step.Hash, hash)
+		} else {
+			hash = hashNode(hash, step.Hash)
+		}
+	}
+	return bytes.Equal(hash, root)
+}
+
+// VerifyHex is Verify for a hex encoded root. A root that is not valid hex
+// verifies nothing.
+func VerifyHex(root string, leaf []byte, proof Proof) bool {
+	sum, err := hex.DecodeString(root)
+	if err != nil {
+		return false
+	}
+	return Verify(sum, leaf, proof)
+}
+
+func hashLeaf(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func hashNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
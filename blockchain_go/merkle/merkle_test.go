@@ -0,0 +1,57 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func leaves(n int) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		out[i] = []byte(fmt.Sprintf("tx-%d", i))
+	}
+	return out
+}
+
+func TestProofsVerifyForEveryLeaf(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		data := leaves(n)
+		tree := New(data)
+		for i := range data {
+			proof, err := tree.Proof(i)
+			require.NoError(t, err)
+			assert.True(t, Verify(tree.Root(), data[i], proof), "n=%d leaf=%d", n, i)
+			assert.False(t, Verify(tree.Root(), []byte("forged"), proof), "n=%d leaf=%d", n, i)
+		}
+	}
+}
+
+func TestRootChangesWithAnyLeaf(t *testing.T) {
+	data := leaves(5)
+	root := New(data).Root()
+
+	data[3] = []byte("tampered")
+	assert.NotEqual(t, root, New(data).Root())
+}
+
+func TestProofOutOfRange(t *testing.T) {
+	tree := New(leaves(3))
+	_, err := tree.Proof(3)
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+	_, err = New(nil).Proof(0)
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+}
+
+func TestBuildAndVerifyHex(t *testing.T) {
+	data := leaves(5)
+	tree := Build(data, func(b []byte) []byte { return b })
+	assert.Equal(t, New(data).Root(), tree.Root())
+
+	proof, err := tree.Proof(3)
+	require.NoError(t, err)
+	assert.True(t, VerifyHex(tree.RootHex(), data[3], proof))
+	assert.False(t, VerifyHex("not hex", data[3], proof))
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Nodes talk JSON over TCP, one request and one response per connection.
+const (
+	msgStatus    = "status"
+	msgGetBlocks = "get_blocks"
+	msgBlocks    = "blocks"
+	msgBlock     = "block"
+	msgAck       = "ack"
+	msgError     = "error"
+
+	maxBlocksPerMessage = 500
+	dialTimeout         = 2 * time.Second
+	ioTimeout           = 10 * time.Second
+)
+
+type message struct {
+	Type   string  `json:"type"`
+	From   string  `json:"from,omitempty"` // advertised address of the sender
+	Height int     `json:"height,omitempty"`
+	Work   uint64  `json:"work,omitempty"`
+	Block  *Block  `json:"block,omitempty"`
+	Blocks []Block `json:"blocks,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// Node serves its chain to peers, gossips new blocks to them and switches to a
+// peer's branch when it carries more cumulative work.
+type Node struct {
+	mu        sync.Mutex // serialises changes to the chain
+	store     *blockStore
+	listener  net.Listener
+	advertise string
+	logger    *log.Logger
+
+	peersMu sync.RWMutex
+	peers   map[string]struct{}
+
+	wg     sync.WaitGroup
+	closed chan struct{}
+}
+
+// NewNode starts listening on listenAddr and serving store to peers.
+// advertiseAddr is the address peers dial to reach the node, which it sends
+// along with every request; if empty it is the listen address, with an
+// unspecified host such as in ":3000" replaced by localhost.
+func NewNode(store *blockStore, listenAddr, advertiseAddr string) (*Node, error) {
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, err
+	}
+	if advertiseAddr == "" {
+		advertiseAddr = localAddr(listener.Addr())
+	}
+	n := &Node{
+		store:     store,
+		listener:  listener,
+		advertise: advertiseAddr,
+		logger:    log.New(os.Stderr, "["+advertiseAddr+"] ", log.LstdFlags),
+		peers:     make(map[string]struct{}),
+		closed:    make(chan struct{}),
+	}
+	store.OnReorg(func(ev ReorgEvent) {
+		n.logger.Printf("reorg after block #%d: disconnected %d blocks, connected %d", ev.Fork.Index, len(ev.Disconnected), len(ev.Connected))
+	})
+	n.wg.Add(1)
+	go n.serve()
+	return n, nil
+}
+
+// Addr is the address the node advertises to its peers.
+func (n *Node) Addr() string {
+	return n.advertise
+}
+
+func localAddr(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || !tcp.IP.IsUnspecified() {
+		return addr.String()
+	}
+	return net.JoinHostPort("localhost", strconv.Itoa(tcp.Port))
+}
+
+func (n *Node) AddPeer(addr string) {
+	if addr == n.Addr() {
+		return
+	}
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+	n.peers[addr] = struct{}{}
+}
+
+func (n *Node) Peers() []string {
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+	peers := make([]string, 0, len(n.peers))
+	for p := range n.peers {
+		peers = append(peers, p)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// Height is the index of the node's tip, or -1 for an empty chain.
+func (n *Node) Height() int {
+	return n.store.Len() - 1
+}
+
+func (n *Node) Tip() (Block, bool) {
+	return n.store.Tip()
+}
+
+// Close stops accepting connections and waits for in-flight ones to finish.
+func (n *Node) Close() error {
+	close(n.closed)
+	err := n.listener.Close()
+	n.wg.Wait()
+	return err
+}
+
+func (n *Node) serve() {
+	defer n.wg.Done()
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			select {
+			case <-n.closed:
+				return
+			default:
+			}
+			n.logger.Println("accept:", err)
+			continue
+		}
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.handle(conn)
+		}()
+	}
+}
+
+func (n *Node) handle(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+	var req message
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		conn.Close()
+		return
+	}
+
+	var resp message
+	switch req.Type {
+	case msgStatus:
+		resp = message{Type: msgStatus, Height: n.Height(), Work: n.work()}
+	case msgGetBlocks:
+		blocks, err := n.blocksFrom(req.Height, maxBlocksPerMessage)
+		if err != nil {
+			resp = message{Type: msgError, Error: err.Error()}
+		} else {
+			resp = message{Type: msgBlocks, Blocks: blocks}
+		}
+	case msgBlock:
+		resp = message{Type: msgAck}
+	default:
+		resp = message{Type: msgError, Error: "unknown message type " + req.Type}
+	}
+	json.NewEncoder(conn).Encode(resp)
+	conn.Close()
+
+	// Blocks are processed after the sender has been answered so gossip never
+	// keeps a chain of connections open across the network.
+	if req.Type == msgBlock && req.Block != nil {
+		n.receiveBlock(*req.Block, req.From)
+	}
+}
+
+func (n *Node) work() uint64 {
+	return n.store.Work()
+}
+
+func (n *Node) blocksFrom(height, limit int) ([]Block, error) {
+	var blocks []Block
+	for i := height; i < n.store.Len() && len(blocks) < limit; i++ {
+		block, err := n.store.BlockByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// MineBlock appends a new block on top of the node's tip and gossips it.
+func (n *Node) MineBlock(miner string, txs []Transaction) (Block, error) {
+	n.mu.Lock()
+	tip, ok := n.store.Tip()
+	if !ok {
+		n.mu.Unlock()
+		return Block{}, errors.New("node has no genesis block")
+	}
+	block, err := genesisBlock(n.store, tip, miner, txs)
+	n.mu.Unlock()
+	if err != nil {
+		return Block{}, err
+	}
+	n.broadcast(block, "")
+	return block, nil
+}
+
+// receiveBlock stores a gossiped block and passes it on. The store decides
+// whether it extends the canonical chain, a side chain or takes over as the
+// heaviest branch. A block whose parent is unknown is a sign the sender is on
+// a chain this node has not seen, so the node syncs with it instead.
+func (n *Node) receiveBlock(block Block, from string) {
+	n.mu.Lock()
+	if _, err := n.store.BlockByHash(block.Hash); err == nil {
+		n.mu.Unlock()
+		return
+	}
+	err := n.store.Append(block)
+	n.mu.Unlock()
+
+	switch {
+	case errors.Is(err, ErrUnknownParent) && from != "":
+		if err := n.SyncWith(from); err != nil {
+			n.logger.Printf("sync with %s: %v", from, err)
+		}
+	case err != nil:
+		n.logger.Printf("rejected block #%d from %s: %v", block.Index, from, err)
+	default:
+		n.broadcast(block, from)
+	}
+}
+
+// broadcast sends block to every peer except the one it came from.
+func (n *Node) broadcast(block Block, except string) {
+	for _, peer := range n.Peers() {
+		if peer == except {
+			continue
+		}
+		if _, err := n.request(peer, message{Type: msgBlock, Block: &block}); err != nil {
+			n.logger.Printf("gossip block #%d to %s: %v", block.Index, peer, err)
+		}
+	}
+}
+
+// Sync asks every peer for its chain and adopts the heaviest one.
+func (n *Node) Sync() error {
+	var errs []error
+	for _, peer := range n.Peers() {
+		if err := n.SyncWith(peer); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", peer, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SyncWith fetches the blocks peer has beyond the point where the two chains
+// fork and stores them, switching branches if they add up to more work than
+// the local one.
+func (n *Node) SyncWith(peer string) error {
+	status, err := n.request(peer, message{Type: msgStatus})
+	if err != nil {
+		return err
+	}
+	if status.Work <= n.work() {
+		return nil
+	}
+
+	// Walk back from the common height, doubling the step, until the peer's
+	// blocks attach to a block we have.
+	start := min(n.store.Len(), status.Height)
+	var branch []Block
+	for step := 1; ; step *= 2 {
+		branch, err = n.fetchBlocks(peer, start)
+		if err != nil {
+			return err
+		}
+		if len(branch) == 0 {
+			return fmt.Errorf("peer has no blocks from height %d", start)
+		}
+		if start == 0 {
+			break
+		}
+		if _, err := n.store.BlockByHash(branch[0].PreviousHash); err == nil {
+			break
+		}
+		start = max(0, start-step)
+	}
+	before, _ := n.store.Tip()
+	if err := n.storeBranch(branch); err != nil {
+		return err
+	}
+	if tip, _ := n.store.Tip(); tip.Hash != before.Hash {
+		n.broadcast(tip, peer)
+	}
+	return nil
+}
+
+func (n *Node) fetchBlocks(peer string, from int) ([]Block, error) {
+	var blocks []Block
+	for {
+		resp, err := n.request(peer, message{Type: msgGetBlocks, Height: from})
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, resp.Blocks...)
+		if len(resp.Blocks) < maxBlocksPerMessage {
+			return blocks, nil
+		}
+		from += len(resp.Blocks)
+	}
+}
+
+// storeBranch appends the blocks of branch the node does not have yet. The
+// store switches to the branch once it is the heaviest it knows, unless that
+// would replace blocks the consensus considers final.
+func (n *Node) storeBranch(branch []Block) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, block := range branch {
+		if _, err := n.store.BlockByHash(block.Hash); err == nil {
+			continue
+		}
+		if err := n.store.Append(block); err != nil {
+			return fmt.Errorf("peer block #%d: %w", block.Index, err)
+		}
+	}
+	return nil
+}
+
+func (n *Node) request(peer string, req message) (message, error) {
+	req.From = n.Addr()
+	conn, err := net.DialTimeout("tcp", peer, dialTimeout)
+	if err != nil {
+		return message{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return message{}, err
+	}
+	var resp message
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return message{}, err
+	}
+	if resp.Type == msgError {
+		return message{}, errors.New(resp.Error)
+	}
+	return resp, nil
+}
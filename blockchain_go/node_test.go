@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestNode(t *testing.T) *Node {
+	store, err := openBlockStore(filepath.Join(t.TempDir(), "chain.db"), testConsensus)
+	require.NoError(t, err)
+	_, err = createGenesisBlock(store)
+	require.NoError(t, err)
+
+	node, err := NewNode(store, "127.0.0.1:0", "")
+	require.NoError(t, err)
+	node.logger = log.New(io.Discard, "", 0)
+	t.Cleanup(func() {
+		node.Close()
+		store.Close()
+	})
+	return node
+}
+
+func connect(nodes ...*Node) {
+	for _, a := range nodes {
+		for _, b := range nodes {
+			a.AddPeer(b.Addr())
+		}
+	}
+}
+
+func tipHash(n *Node) string {
+	tip, _ := n.Tip()
+	return tip.Hash
+}
+
+func TestNodeAdvertisesReachableAddress(t *testing.T) {
+	store, err := openBlockStore(filepath.Join(t.TempDir(), "chain.db"), testConsensus)
+	require.NoError(t, err)
+	defer store.Close()
+
+	wildcard, err := NewNode(store, ":0", "")
+	require.NoError(t, err)
+	defer wildcard.Close()
+	assert.True(t, strings.HasPrefix(wildcard.Addr(), "localhost:"), wildcard.Addr())
+
+	advertised, err := NewNode(store, "127.0.0.1:0", "node-a.example:3000")
+	require.NoError(t, err)
+	defer advertised.Close()
+	assert.Equal(t, "node-a.example:3000", advertised.Addr())
+}
+
+func TestNodesGossipMinedBlocks(t *testing.T) {
+	a, b, c := newTestNode(t), newTestNode(t), newTestNode(t)
+	connect(a, b, c)
+	miner := testWallet(t)
+
+	for i := 0; i < 3; i++ {
+		_, err := a.MineBlock(miner.Address(), nil)
+		require.NoError(t, err)
+	}
+	_, err := c.MineBlock(miner.Address(), nil)
+	require.NoError(t, err)
+
+	for _, n := range []*Node{a, b, c} {
+		assert.Eventually(t, func() bool { return n.Height() == 4 && tipHash(n) == tipHash(c) }, 5*time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestLateNodeFetchesMissingBlocks(t *testing.T) {
+	a, b := newTestNode(t), newTestNode(t)
+	connect(a, b)
+	miner := testWallet(t)
+	for i := 0; i < 5; i++ {
+		_, err := a.MineBlock(miner.Address(), nil)
+		require.NoError(t, err)
+	}
+
+	late := newTestNode(t)
+	late.AddPeer(a.Addr())
+	require.NoError(t, late.Sync())
+	assert.Equal(t, 5, late.Height())
+	assert.Equal(t, tipHash(a), tipHash(late))
+	assert.Equal(t, 5*blockReward, late.store.UTXO().BalanceOf(miner.Address()))
+}
+
+func TestNodesResolveForkByCumulativeWork(t *testing.T) {
+	a, b, c := newTestNode(t), newTestNode(t), newTestNode(t)
+	alice, bob := testWallet(t), testWallet(t)
+
+	// While partitioned, a and b mine competing branches; b's is heavier.
+	for i := 0; i < 2; i++ {
+		_, err := a.MineBlock(alice.Address(), nil)
+		require.NoError(t, err)
+	}
+	for i := 0; i < 4; i++ {
+		_, err := b.MineBlock(bob.Address(), nil)
+		require.NoError(t, err)
+	}
+
+	connect(a, b, c)
+	require.NoError(t, a.Sync())
+	require.NoError(t, c.Sync())
+
+	for _, n := range []*Node{a, b, c} {
+		assert.Equal(t, 4, n.Height())
+		assert.Equal(t, tipHash(b), tipHash(n))
+	}
+	// a's orphaned coinbase rewards are gone after the switch.
+	assert.Zero(t, a.store.UTXO().BalanceOf(alice.Address()))
+	assert.Equal(t, 4*blockReward, a.store.UTXO().BalanceOf(bob.Address()))
+
+	// The lighter branch never replaces the heavier one.
+	require.NoError(t, b.SyncWith(a.Addr()))
+	assert.Equal(t, 4, b.Height())
+}
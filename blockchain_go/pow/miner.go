@@ -0,0 +1,101 @@
+package pow
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Workers only look at the stop signal every checkInterval hashes so the hot
+// loop stays cheap.
+const checkInterval = 1024
+
+type MiningStats struct {
+	Workers int
+	Hashes  uint64
+	Elapsed time.Duration
+}
+
+// HashRate is the number of hashes computed per second across all workers.
+func (s MiningStats) HashRate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Hashes) / s.Elapsed.Seconds()
+}
+
+func (s MiningStats) String() string {
+	return fmt.Sprintf("%d hashes by %d workers in %s (%.0f H/s)", s.Hashes, s.Workers, s.Elapsed.Round(time.Millisecond), s.HashRate())
+}
+
+// Miner searches for a nonce using several goroutines. Worker w tries nonces
+// start+w, start+w+N, ... so no two workers ever hash the same candidate. With
+// Workers unset or not positive it uses one worker per CPU, as NewMiner does.
+type Miner struct {
+	Workers int
+}
+
+func NewMiner(workers int) *Miner {
+	return &Miner{Workers: minerWorkers(workers)}
+}
+
+func minerWorkers(n int) int {
+	if n <= 0 {
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// Mine returns the first nonce found, counting up from start, whose hash
+// meets target. hash is called from every worker at once, so it must not
+// share mutable state between calls. Mine returns as soon as one worker
+// succeeds, or with ctx.Err() if ctx is done first.
+func (m *Miner) Mine(ctx context.Context, start uint64, target *big.Int, hash func(nonce uint64) [32]byte) (uint64, MiningStats, error) {
+	workers := minerWorkers(m.Workers)
+	stats := MiningStats{Workers: workers}
+	begin := time.Now()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	found := make(chan uint64, 1)
+	var hashes atomic.Uint64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var count uint64
+			defer func() { hashes.Add(count) }()
+			for nonce := start + uint64(w); ; nonce += uint64(workers) {
+				if count%checkInterval == 0 && ctx.Err() != nil {
+					return
+				}
+				sum := hash(nonce)
+				count++
+				if MeetsTarget(sum[:], target) {
+					select {
+					case found <- nonce:
+						cancel()
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats.Hashes = hashes.Load()
+	stats.Elapsed = time.Since(begin)
+	select {
+	case nonce := <-found:
+		return nonce, stats, nil
+	default:
+		return 0, stats, ctx.Err()
+	}
+}
@@ -0,0 +1,67 @@
+package pow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hashNonce(nonce uint64) [32]byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], nonce)
+	return sha256.Sum256(buf[:])
+}
+
+func TestMinerFindsValidNonce(t *testing.T) {
+	target := TargetFromZeroBits(12)
+
+	nonce, stats, err := NewMiner(4).Mine(context.Background(), 0, target, hashNonce)
+	require.NoError(t, err)
+	sum := hashNonce(nonce)
+	assert.True(t, MeetsTarget(sum[:], target))
+	assert.Zero(t, sum[0])
+	assert.Equal(t, 4, stats.Workers)
+	assert.NotZero(t, stats.Hashes)
+}
+
+func TestZeroMinerStillMines(t *testing.T) {
+	target := TargetFromZeroBits(8)
+
+	nonce, stats, err := (&Miner{}).Mine(context.Background(), 0, target, hashNonce)
+	require.NoError(t, err)
+	sum := hashNonce(nonce)
+	assert.True(t, MeetsTarget(sum[:], target))
+	assert.Positive(t, stats.Workers)
+}
+
+func TestMinerStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, stats, err := NewMiner(4).Mine(ctx, 0, TargetFromZeroBits(64), hashNonce)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.NotZero(t, stats.HashRate())
+}
+
+func TestTargetRoundTrip(t *testing.T) {
+	target := TargetFromZeroBits(16)
+	assert.Equal(t, 16, ZeroBits(target))
+	decoded, err := DecodeTarget(EncodeTarget(target))
+	require.NoError(t, err)
+	assert.Equal(t, target, decoded)
+	_, err = DecodeTarget("ff")
+	assert.Error(t, err)
+
+	hash := make([]byte, 32)
+	assert.True(t, MeetsTarget(hash, target))
+	hash[1] = 1
+	assert.False(t, MeetsTarget(hash, target))
+	assert.True(t, MeetsTarget(hash, TargetFromZeroBits(15)))
+}
@@ -0,0 +1,40 @@
+// Package pow is the proof of work shared by the chains in this repository. A
+// block is valid when its hash, read as a 256-bit number, is at or below a
+// target; lowering the target by half doubles the expected work. Miner
+// searches for such a hash with several goroutines.
+package pow
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// TargetFromZeroBits returns the target that requires a hash to start with
+// the given number of zero bits.
+func TargetFromZeroBits(bits int) *big.Int {
+	target := new(big.Int).Lsh(big.NewInt(1), uint(256-bits))
+	return target.Sub(target, big.NewInt(1))
+}
+
+// ZeroBits is the number of leading zero bits target demands.
+func ZeroBits(target *big.Int) int {
+	return 256 - target.BitLen()
+}
+
+// EncodeTarget formats target as the 64 hex digits blocks carry.
+func EncodeTarget(target *big.Int) string {
+	return fmt.Sprintf("%064x", target)
+}
+
+func DecodeTarget(s string) (*big.Int, error) {
+	target, ok := new(big.Int).SetString(s, 16)
+	if !ok || len(s) != 64 {
+		return nil, fmt.Errorf("malformed target %q", s)
+	}
+	return target, nil
+}
+
+// MeetsTarget reports whether hash is a valid proof of work for target.
+func MeetsTarget(hash []byte, target *big.Int) bool {
+	return new(big.Int).SetBytes(hash).Cmp(target) <= 0
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/hex"
+	"math/big"
+	"time"
+
+	"revisitgo/blockchain_go/pow"
+)
+
+// A block is valid when its hash meets the target recorded in the block, see
+// package pow. The target is retargeted every few blocks to keep block times
+// steady.
+const (
+	genesisZeroBits  = 16 // the same work as the old "0000" prefix
+	minZeroBits      = 4  // easiest target retargeting may ever reach
+	retargetInterval = 5  // blocks between adjustments
+	targetBlockTime  = 200 * time.Millisecond
+	maxAdjustFactor  = 4 // a single retarget moves the target at most 4x
+)
+
+var (
+	genesisTarget = pow.TargetFromZeroBits(genesisZeroBits)
+	maxTarget     = pow.TargetFromZeroBits(minZeroBits)
+)
+
+// nextTarget returns the target the block following chain must carry. Every
+// retargetInterval blocks the target is scaled by how long the last interval
+// actually took compared to targetBlockTime.
+func nextTarget(chain []Block) string {
+	if len(chain) == 0 {
+		return pow.EncodeTarget(genesisTarget)
+	}
+	tip := chain[len(chain)-1]
+	height := len(chain)
+	if height%retargetInterval != 0 {
+		return tip.Target
+	}
+	prevTarget, err := pow.DecodeTarget(tip.Target)
+	if err != nil {
+		// The tip itself fails validation; keep the slot deterministic.
+		return pow.EncodeTarget(genesisTarget)
+	}
+
+	first := chain[height-retargetInterval]
+	expected := int64(targetBlockTime) * (retargetInterval - 1)
+	actual := tip.Timestamp - first.Timestamp
+	if actual < expected/maxAdjustFactor {
+		actual = expected / maxAdjustFactor
+	}
+	if actual > expected*maxAdjustFactor {
+		actual = expected * maxAdjustFactor
+	}
+
+	target := new(big.Int).Mul(prevTarget, big.NewInt(actual))
+	target.Div(target, big.NewInt(expected))
+	if target.Cmp(maxTarget) > 0 {
+		target.Set(maxTarget)
+	}
+	return pow.EncodeTarget(target)
+}
+
+// hashMeetsTarget reports whether the hex hash is a valid proof of work for
+// the hex target.
+func hashMeetsTarget(hash, target string) bool {
+	h, err := hex.DecodeString(hash)
+	if err != nil {
+		return false
+	}
+	t, err := pow.DecodeTarget(target)
+	if err != nil {
+		return false
+	}
+	return pow.MeetsTarget(h, t)
+}
+
+// zeroBits is the number of leading zero bits a target demands, for display.
+func zeroBits(target string) int {
+	t, err := pow.DecodeTarget(target)
+	if err != nil {
+		return 0
+	}
+	return pow.ZeroBits(t)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"revisitgo/blockchain_go/pow"
+	"revisitgo/blockchain_go/validation"
+)
+
+// chainWithSpacing builds an unmined chain whose blocks are spacing apart and
+// carry the targets the retargeting rules expect.
+func chainWithSpacing(n int, spacing time.Duration) []Block {
+	var chain []Block
+	for i := 0; i < n; i++ {
+		chain = append(chain, Block{Index: i, Timestamp: int64(i) * int64(spacing), Target: nextTarget(chain)})
+	}
+	return chain
+}
+
+func TestNextTargetKeepsTargetBetweenRetargets(t *testing.T) {
+	chain := chainWithSpacing(retargetInterval-1, time.Millisecond)
+	assert.Equal(t, pow.EncodeTarget(genesisTarget), nextTarget(chain))
+}
+
+func TestNextTargetRetargets(t *testing.T) {
+	onTime := chainWithSpacing(retargetInterval, targetBlockTime)
+	assert.Equal(t, pow.EncodeTarget(genesisTarget), nextTarget(onTime))
+
+	// Blocks twice as slow as planned halve the work, i.e. one fewer zero bit.
+	slow := chainWithSpacing(retargetInterval, 2*targetBlockTime)
+	assert.Equal(t, genesisZeroBits-1, zeroBits(nextTarget(slow)))
+
+	// Very fast blocks are clamped to a 4x (two bit) increase.
+	fast := chainWithSpacing(retargetInterval, time.Nanosecond)
+	assert.Equal(t, genesisZeroBits+2, zeroBits(nextTarget(fast)))
+}
+
+func TestValidateChainRejectsWrongTarget(t *testing.T) {
+	chain := []Block{createGenesisBlock()}
+	for i := 0; i < 2; i++ {
+		chain = append(chain, generateBlock(chain, nil))
+	}
+	assert.True(t, ValidateChain(chain).Valid())
+
+	// Claiming an easier target and re-mining does not make the block valid.
+	chain[2].Target = pow.EncodeTarget(pow.TargetFromZeroBits(1))
+	mineBlock(&chain[2])
+
+	report := ValidateChain(chain)
+	assert.Equal(t, 2, report.FirstInvalid)
+	assert.Equal(t, []validation.LinkError{{
+		Position: 2,
+		Check:    CheckTarget,
+		Expected: pow.EncodeTarget(genesisTarget),
+		Actual:   chain[2].Target,
+	}}, report.Errors)
+}
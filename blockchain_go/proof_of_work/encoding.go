@@ -0,0 +1,28 @@
+package main
+
+import "revisitgo/blockchain_go/codec"
+
+// blockEncodingVersion is written first in every encoded header. Bump it
+// whenever a field is added, removed or reordered.
+const blockEncodingVersion = 2
+
+// encodeHeader returns the canonical header bytes that calculateHash commits
+// to. The miner re-encodes the header for every nonce it tries.
+func encodeHeader(block Block) []byte {
+	var e codec.Encoder
+	e.Uint8(blockEncodingVersion)
+	e.Uint64(uint64(block.Index))
+	e.Int64(block.Timestamp)
+	e.String(block.Target)
+	e.String(block.PreviousHash)
+	e.String(block.MerkleRoot)
+	e.Uint64(uint64(block.Nonce))
+	return e.Bytes()
+}
+
+func writeTransaction(e *codec.Encoder, tx Transaction) {
+	e.String(tx.From)
+	e.String(tx.To)
+	e.Int64(int64(tx.Amount))
+	e.Int64(int64(tx.Fee))
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The golden vector pins the header encoding the miner hashes. If it changes,
+// bump blockEncodingVersion instead of updating the vector.
+func TestEncodeHeaderGolden(t *testing.T) {
+	block := Block{
+		Index:        1,
+		Timestamp:    1700000000000000000,
+		Target:       "ff",
+		PreviousHash: "ab",
+		MerkleRoot:   "cd",
+		Nonce:        42,
+	}
+	assert.Equal(t, "02000000000000000117979cfe362a0000000000026666000000026162000000026364000000000000002a", hex.EncodeToString(encodeHeader(block)))
+	assert.Equal(t, "41934a504e031d9ffda6cdfbe3984c5bf93f5552cc07ee44b4d9c1244d2d775b", calculateHash(block))
+}
@@ -1,96 +1,111 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"strings"
 	"time"
+
+	"revisitgo/blockchain_go/pow"
 )
 
 type Block struct {
 	Index        int
-	Timestamp    string
-	Data         string
+	Timestamp    int64 // Unix nanoseconds
+	Target       string
+	MerkleRoot   string
+	Transactions []Transaction
 	PreviousHash string
 	Hash         string
 	Nonce        int
 }
 
 func calculateHash(block Block) string {
-	record := fmt.Sprintf("%d%s%s%s%d", block.Index, block.Timestamp, block.Data, block.PreviousHash, block.Nonce)
-	h := sha256.New()
-	h.Write([]byte(record))
-	return hex.EncodeToString(h.Sum(nil))
+	sum := sha256.Sum256(encodeHeader(block))
+	return hex.EncodeToString(sum[:])
 }
 
-func mineBlock(block *Block, difficulty int) {
-	prefix := strings.Repeat("0", difficulty)
-	for {
-		block.Hash = calculateHash(*block)
-		if strings.HasPrefix(block.Hash, prefix) {
-			break
-		}
-		block.Nonce++
-	}
+func mineBlock(block *Block) {
+	// Without a deadline mine only returns once a nonce has been found.
+	mine(context.Background(), pow.NewMiner(0), block)
 }
 
-func createGenesisBlock(difficulty int) Block {
+func createGenesisBlock() Block {
 	genesis := Block{
 		Index:        0,
-		Timestamp:    time.Now().String(),
-		Data:         "Genesis Block",
+		Timestamp:    time.Now().UnixNano(),
+		Target:       nextTarget(nil),
+		MerkleRoot:   calculateMerkleRoot(nil),
 		PreviousHash: "",
 		Nonce:        0,
 	}
-	mineBlock(&genesis, difficulty)
+	mineBlock(&genesis)
 	return genesis
 }
 
-func generateBlock(prev Block, data string, difficulty int) Block {
-	newBlock := Block{
+// newBlock builds the next, not yet mined, block on top of chain using the
+// target the retargeting rules expect at that height.
+func newBlock(chain []Block, txs []Transaction) Block {
+	prev := chain[len(chain)-1]
+	return Block{
 		Index:        prev.Index + 1,
-		Timestamp:    time.Now().String(),
-		Data:         data,
+		Timestamp:    time.Now().UnixNano(),
+		Target:       nextTarget(chain),
+		MerkleRoot:   calculateMerkleRoot(txs),
+		Transactions: txs,
 		PreviousHash: prev.Hash,
 		Nonce:        0,
 	}
-	mineBlock(&newBlock, difficulty)
-	return newBlock
 }
 
-func isBlockValid(newBlock, prevBlock Block, difficulty int) bool {
-	if newBlock.Index != prevBlock.Index+1 {
-		return false
-	}
-	if newBlock.PreviousHash != prevBlock.Hash {
-		return false
-	}
-	if calculateHash(newBlock) != newBlock.Hash {
-		return false
-	}
-	prefix := strings.Repeat("0", difficulty)
-	if !strings.HasPrefix(newBlock.Hash, prefix) {
-		return false
-	}
-	return true
+func generateBlock(chain []Block, txs []Transaction) Block {
+	block := newBlock(chain, txs)
+	mineBlock(&block)
+	return block
 }
 
-func main() {
-	difficulty := 4
-	blockchain := []Block{createGenesisBlock(difficulty)}
+func isBlockValid(newBlock, prevBlock Block, target string) bool {
+	return len(linkErrors(newBlock, prevBlock, target)) == 0
+}
 
-	block1 := generateBlock(blockchain[len(blockchain)-1], "Send 1 BTC to Alice", difficulty)
-	block2 := generateBlock(blockchain[len(blockchain)-1], "Send 2 BTC to Bob", difficulty)
+func main() {
+	blockchain := []Block{createGenesisBlock()}
+	mempool := NewMempool(100, time.Minute)
 
-	blockchain = append(blockchain, block1, block2)
+	// Three payments arrive per block but only two fit, so the cheapest one
+	// waits and competes with the next round.
+	for i := 1; i <= 2*retargetInterval; i++ {
+		for j, to := range []string{"Alice", "Bob", "Carol"} {
+			mempool.Add(Transaction{From: "Satoshi", To: to, Amount: i, Fee: (i + j) % 4})
+		}
+		block := newBlockTemplate(blockchain, mempool, maxBlockTxBytes)
+		mineBlock(&block)
+		mempool.Remove(block.Transactions)
+		blockchain = append(blockchain, block)
+	}
+	fmt.Println("Left in mempool:", mempool.Pending())
 
 	for _, block := range blockchain {
 		fmt.Printf("\n--- Block #%d ---\n", block.Index)
-		fmt.Println("Timestamp   :", block.Timestamp)
-		fmt.Println("Data        :", block.Data)
+		fmt.Println("Timestamp   :", time.Unix(0, block.Timestamp))
+		fmt.Printf("Target      : %s (%d zero bits)\n", block.Target, zeroBits(block.Target))
+		fmt.Println("Merkle Root :", block.MerkleRoot)
+		fmt.Println("Transactions:", block.Transactions)
 		fmt.Println("Nonce       :", block.Nonce)
 		fmt.Println("Prev. Hash  :", block.PreviousHash)
 		fmt.Println("Hash        :", block.Hash)
 	}
+
+	// Mining with a deadline: a much harder block is abandoned when it expires.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	hard := Block{Index: 99, Timestamp: time.Now().UnixNano(), Target: pow.EncodeTarget(pow.TargetFromZeroBits(48)), MerkleRoot: calculateMerkleRoot(nil)}
+	stats, err := mine(ctx, pow.NewMiner(0), &hard)
+	fmt.Println("\nMining 48 zero bits:", err)
+	fmt.Println("Stats       :", stats)
+
+	blockchain[1].Transactions[0].Amount = 100
+	fmt.Println()
+	fmt.Println(ValidateChain(blockchain))
 }
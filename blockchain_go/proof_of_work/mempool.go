@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxBlockTxBytes caps the encoded size of the transactions in one block.
+const maxBlockTxBytes = 80
+
+var (
+	ErrDuplicateTx = errors.New("transaction already in mempool")
+	ErrInvalidTx   = errors.New("invalid transaction")
+	ErrMempoolFull = errors.New("mempool is full and the transaction pays too little")
+)
+
+type mempoolEntry struct {
+	tx      Transaction
+	id      string
+	size    int
+	addedAt time.Time
+	seq     uint64 // arrival order, breaks fee ties
+}
+
+// Mempool holds transactions waiting to be mined. It is safe for concurrent
+// use by the goroutines that accept transactions and the one building blocks.
+type Mempool struct {
+	mu      sync.Mutex
+	entries map[string]*mempoolEntry
+	seq     uint64
+	maxSize int
+	maxAge  time.Duration
+	now     func() time.Time
+}
+
+// NewMempool returns a pool holding at most maxSize transactions, each for at
+// most maxAge before it is evicted as stale. A maxSize below 1 is taken as 1.
+func NewMempool(maxSize int, maxAge time.Duration) *Mempool {
+	return &Mempool{
+		entries: make(map[string]*mempoolEntry),
+		maxSize: max(maxSize, 1),
+		maxAge:  maxAge,
+		now:     time.Now,
+	}
+}
+
+// Add queues tx. When the pool is full the lowest paying transaction makes
+// room, unless tx itself pays no more than it.
+func (m *Mempool) Add(tx Transaction) error {
+	if tx.Amount <= 0 || tx.Fee < 0 || tx.From == "" || tx.To == "" {
+		return ErrInvalidTx
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := tx.ID()
+	if _, ok := m.entries[id]; ok {
+		return ErrDuplicateTx
+	}
+	m.evictStale()
+	if len(m.entries) >= m.maxSize {
+		lowest := m.sorted()[len(m.entries)-1]
+		if tx.Fee <= lowest.tx.Fee {
+			return ErrMempoolFull
+		}
+		delete(m.entries, lowest.id)
+	}
+
+	m.seq++
+	m.entries[id] = &mempoolEntry{tx: tx, id: id, size: len(tx.serialize()), addedAt: m.now(), seq: m.seq}
+	return nil
+}
+
+func (m *Mempool) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// Pending returns the queued transactions, highest fee first.
+func (m *Mempool) Pending() []Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evictStale()
+	txs := make([]Transaction, 0, len(m.entries))
+	for _, e := range m.sorted() {
+		txs = append(txs, e.tx)
+	}
+	return txs
+}
+
+// Remove drops txs from the pool, typically once they have been mined.
+func (m *Mempool) Remove(txs []Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, tx := range txs {
+		delete(m.entries, tx.ID())
+	}
+}
+
+// EvictStale drops every transaction older than the pool's max age and
+// returns how many were removed.
+func (m *Mempool) EvictStale() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.evictStale()
+}
+
+func (m *Mempool) evictStale() int {
+	if m.maxAge <= 0 {
+		return 0
+	}
+	cutoff := m.now().Add(-m.maxAge)
+	evicted := 0
+	for id, e := range m.entries {
+		if e.addedAt.Before(cutoff) {
+			delete(m.entries, id)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// sorted orders entries by fee, highest first, then by arrival.
+func (m *Mempool) sorted() []*mempoolEntry {
+	entries := make([]*mempoolEntry, 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].tx.Fee != entries[j].tx.Fee {
+			return entries[i].tx.Fee > entries[j].tx.Fee
+		}
+		return entries[i].seq < entries[j].seq
+	})
+	return entries
+}
+
+// selectTransactions picks the best paying transactions whose encoded size
+// adds up to at most maxBytes. A transaction that does not fit is skipped so
+// smaller ones behind it can still fill the block.
+func (m *Mempool) selectTransactions(maxBytes int) []Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evictStale()
+	var txs []Transaction
+	used := 0
+	for _, e := range m.sorted() {
+		if used+e.size > maxBytes {
+			continue
+		}
+		txs = append(txs, e.tx)
+		used += e.size
+	}
+	return txs
+}
+
+// newBlockTemplate fills the next block on top of chain from the mempool,
+// ready to be handed to mineBlock.
+func newBlockTemplate(chain []Block, pool *Mempool, maxBytes int) Block {
+	return newBlock(chain, pool.selectTransactions(maxBytes))
+}
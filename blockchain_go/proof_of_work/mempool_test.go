@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"revisitgo/blockchain_go/pow"
+)
+
+func TestMempoolOrdersByFeeThenArrival(t *testing.T) {
+	pool := NewMempool(10, 0)
+	require.NoError(t, pool.Add(Transaction{From: "a", To: "b", Amount: 1, Fee: 1}))
+	require.NoError(t, pool.Add(Transaction{From: "a", To: "c", Amount: 1, Fee: 5}))
+	require.NoError(t, pool.Add(Transaction{From: "a", To: "d", Amount: 1, Fee: 1}))
+
+	var to []string
+	for _, tx := range pool.Pending() {
+		to = append(to, tx.To)
+	}
+	assert.Equal(t, []string{"c", "b", "d"}, to)
+}
+
+func TestMempoolRejectsDuplicatesAndInvalid(t *testing.T) {
+	pool := NewMempool(10, 0)
+	tx := Transaction{From: "a", To: "b", Amount: 1, Fee: 1}
+	require.NoError(t, pool.Add(tx))
+	assert.ErrorIs(t, pool.Add(tx), ErrDuplicateTx)
+	assert.ErrorIs(t, pool.Add(Transaction{From: "a", To: "b", Amount: 0}), ErrInvalidTx)
+	assert.ErrorIs(t, pool.Add(Transaction{From: "a", To: "b", Amount: 1, Fee: -1}), ErrInvalidTx)
+	assert.Equal(t, 1, pool.Len())
+}
+
+func TestMempoolEvictsLowestFeeWhenFull(t *testing.T) {
+	pool := NewMempool(2, 0)
+	require.NoError(t, pool.Add(Transaction{From: "a", To: "b", Amount: 1, Fee: 2}))
+	require.NoError(t, pool.Add(Transaction{From: "a", To: "c", Amount: 1, Fee: 1}))
+
+	assert.ErrorIs(t, pool.Add(Transaction{From: "a", To: "d", Amount: 1, Fee: 1}), ErrMempoolFull)
+	require.NoError(t, pool.Add(Transaction{From: "a", To: "e", Amount: 1, Fee: 3}))
+
+	pending := pool.Pending()
+	require.Len(t, pending, 2)
+	assert.Equal(t, "e", pending[0].To)
+	assert.Equal(t, "b", pending[1].To)
+}
+
+func TestMempoolWithoutRoomHoldsOne(t *testing.T) {
+	pool := NewMempool(0, 0)
+	require.NoError(t, pool.Add(Transaction{From: "a", To: "b", Amount: 1, Fee: 1}))
+	require.NoError(t, pool.Add(Transaction{From: "a", To: "c", Amount: 1, Fee: 2}))
+	assert.Equal(t, 1, pool.Len())
+}
+
+func TestMempoolEvictsStaleEntries(t *testing.T) {
+	now := time.Unix(0, 0)
+	pool := NewMempool(10, time.Minute)
+	pool.now = func() time.Time { return now }
+
+	require.NoError(t, pool.Add(Transaction{From: "a", To: "b", Amount: 1}))
+	now = now.Add(45 * time.Second)
+	require.NoError(t, pool.Add(Transaction{From: "a", To: "c", Amount: 1}))
+	now = now.Add(30 * time.Second)
+
+	assert.Equal(t, 1, pool.EvictStale())
+	pending := pool.Pending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, "c", pending[0].To)
+}
+
+func TestMempoolConcurrentAdds(t *testing.T) {
+	pool := NewMempool(1000, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				pool.Add(Transaction{From: fmt.Sprint(i), To: fmt.Sprint(j), Amount: 1, Fee: j % 7})
+				pool.Pending()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 400, pool.Len())
+}
+
+func TestBlockTemplateFillsUpToSizeLimit(t *testing.T) {
+	chain := []Block{{Index: 0, Target: pow.EncodeTarget(pow.TargetFromZeroBits(minZeroBits)), Hash: "genesis"}}
+	pool := NewMempool(10, 0)
+	big := Transaction{From: "satoshi-with-a-name-long-enough-to-crowd-the-block", To: "alice", Amount: 1, Fee: 9}
+	small1 := Transaction{From: "s", To: "bob", Amount: 1, Fee: 5}
+	small2 := Transaction{From: "s", To: "carol", Amount: 1, Fee: 1}
+	for _, tx := range []Transaction{small2, big, small1} {
+		require.NoError(t, pool.Add(tx))
+	}
+
+	// big pays the most and is picked first; only small1 still fits after it.
+	limit := len(big.serialize()) + len(small1.serialize())
+	block := newBlockTemplate(chain, pool, limit)
+	assert.Equal(t, []Transaction{big, small1}, block.Transactions)
+	assert.Equal(t, 1, block.Index)
+	assert.Equal(t, "genesis", block.PreviousHash)
+	assert.Equal(t, calculateMerkleRoot(block.Transactions), block.MerkleRoot)
+	assert.Empty(t, block.Hash)
+
+	// With too little room for big, the smaller ones behind it still fit.
+	block = newBlockTemplate(chain, pool, len(small1.serialize())+len(small2.serialize()))
+	assert.Equal(t, []Transaction{small1, small2}, block.Transactions)
+
+	mineBlock(&block)
+	pool.Remove(block.Transactions)
+	assert.True(t, isBlockValid(block, chain[0], block.Target))
+	assert.Equal(t, []Transaction{big}, pool.Pending())
+}
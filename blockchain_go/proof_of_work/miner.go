@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+
+	"revisitgo/blockchain_go/pow"
+)
+
+// mine fills in block.Nonce and block.Hash using miner. If ctx is done first
+// it returns ctx.Err() and leaves block untouched.
+func mine(ctx context.Context, miner *pow.Miner, block *Block) (pow.MiningStats, error) {
+	target, err := pow.DecodeTarget(block.Target)
+	if err != nil {
+		return pow.MiningStats{}, err
+	}
+	nonce, stats, err := miner.Mine(ctx, uint64(block.Nonce), target, func(nonce uint64) [32]byte {
+		candidate := *block
+		candidate.Nonce = int(nonce)
+		return sha256.Sum256(encodeHeader(candidate))
+	})
+	if err != nil {
+		return stats, err
+	}
+	block.Nonce = int(nonce)
+	block.Hash = calculateHash(*block)
+	return stats, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"revisitgo/blockchain_go/pow"
+)
+
+func TestMineFillsNonceAndHash(t *testing.T) {
+	block := Block{Index: 1, Timestamp: 1, Target: pow.EncodeTarget(pow.TargetFromZeroBits(12)), MerkleRoot: calculateMerkleRoot(nil)}
+
+	stats, err := mine(context.Background(), pow.NewMiner(4), &block)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(block.Hash, "000"))
+	assert.Equal(t, calculateHash(block), block.Hash)
+	assert.True(t, hashMeetsTarget(block.Hash, block.Target))
+	assert.Equal(t, 4, stats.Workers)
+}
+
+func TestMineLeavesBlockUntouchedOnCancel(t *testing.T) {
+	block := Block{Index: 1, Timestamp: 1, Target: pow.EncodeTarget(pow.TargetFromZeroBits(64)), MerkleRoot: calculateMerkleRoot(nil)}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := mine(ctx, pow.NewMiner(4), &block)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, block.Hash)
+	assert.Zero(t, block.Nonce)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"revisitgo/blockchain_go/codec"
+	"revisitgo/blockchain_go/merkle"
+)
+
+type Transaction struct {
+	From   string
+	To     string
+	Amount int
+	Fee    int // paid to the miner, decides the order blocks pick transactions in
+}
+
+func (tx Transaction) serialize() []byte {
+	var e codec.Encoder
+	writeTransaction(&e, tx)
+	return e.Bytes()
+}
+
+func (tx Transaction) ID() string {
+	sum := sha256.Sum256(tx.serialize())
+	return hex.EncodeToString(sum[:])
+}
+
+func merkleTree(txs []Transaction) *merkle.Tree {
+	return merkle.Build(txs, Transaction.serialize)
+}
+
+func calculateMerkleRoot(txs []Transaction) string {
+	return merkleTree(txs).RootHex()
+}
+
+// TransactionProof returns the inclusion proof for the i-th transaction in block.
+func TransactionProof(block Block, i int) (merkle.Proof, error) {
+	return merkleTree(block.Transactions).Proof(i)
+}
+
+// VerifyTransaction lets a light client that only holds a block header check
+// that tx is part of the block.
+func VerifyTransaction(merkleRoot string, tx Transaction, proof merkle.Proof) bool {
+	return merkle.VerifyHex(merkleRoot, tx.serialize(), proof)
+}
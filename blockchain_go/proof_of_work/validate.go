@@ -0,0 +1,54 @@
+package main
+
+import "revisitgo/blockchain_go/validation"
+
+// Checks of the proof of work rules this chain adds to the shared ones.
+const (
+	CheckTarget      validation.Check = "target"
+	CheckProofOfWork validation.Check = "proof of work"
+)
+
+// ValidateChain walks the whole chain, genesis included, and reports every
+// broken check instead of stopping at the first one.
+func ValidateChain(blocks []Block) validation.ChainReport {
+	report := validation.NewChainReport(len(blocks))
+	for i, block := range blocks {
+		var errs []validation.LinkError
+		if i == 0 {
+			errs = genesisErrors(block)
+		} else {
+			errs = linkErrors(block, blocks[i-1], nextTarget(blocks[:i]))
+		}
+		report.Add(i, errs)
+	}
+	return report
+}
+
+func genesisErrors(genesis Block) []validation.LinkError {
+	errs := validation.Genesis(genesis.Index, genesis.PreviousHash)
+	return append(errs, hashErrors(genesis, nextTarget(nil))...)
+}
+
+// linkErrors checks newBlock against its predecessor and the target the
+// retargeting rules expect at its height.
+func linkErrors(newBlock, prevBlock Block, target string) []validation.LinkError {
+	errs := validation.Link(prevBlock.Index, prevBlock.Hash, newBlock.Index, newBlock.PreviousHash)
+	return append(errs, hashErrors(newBlock, target)...)
+}
+
+func hashErrors(block Block, target string) []validation.LinkError {
+	var errs []validation.LinkError
+	if root := calculateMerkleRoot(block.Transactions); block.MerkleRoot != root {
+		errs = append(errs, validation.LinkError{Check: validation.CheckMerkleRoot, Expected: root, Actual: block.MerkleRoot})
+	}
+	if hash := calculateHash(block); block.Hash != hash {
+		errs = append(errs, validation.LinkError{Check: validation.CheckHash, Expected: hash, Actual: block.Hash})
+	}
+	if block.Target != target {
+		errs = append(errs, validation.LinkError{Check: CheckTarget, Expected: target, Actual: block.Target})
+	}
+	if !hashMeetsTarget(block.Hash, block.Target) {
+		errs = append(errs, validation.LinkError{Check: CheckProofOfWork, Expected: "hash <= " + block.Target, Actual: block.Hash})
+	}
+	return errs
+}
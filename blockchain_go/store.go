@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// Every record in the store file is laid out as
+//
+//	[4 byte length][4 byte crc32 of payload][payload]
+//
+// where the payload is the canonical encoding produced by encodeBlock.
+// Records are only ever appended, side chain blocks included, and every block
+// comes after its parent. A crash in the middle of an append leaves a torn
+// record at the tail which is cut off the next time the store is opened; a
+// damaged record anywhere before the tail is reported as corruption.
+const (
+	recordHeaderSize = 8
+	maxRecordSize    = 16 << 20
+)
+
+var (
+	ErrBlockNotFound = errors.New("block not found")
+	ErrInvalidChain  = errors.New("stored chain is invalid")
+	ErrUnknownParent = errors.New("parent block is unknown")
+	ErrFinalized     = errors.New("branch would replace a final block")
+
+	errTornRecord = errors.New("torn record")
+)
+
+// blockStore keeps every block it is given in a tree of branches and follows
+// the heaviest one. Index based lookups, Tip, Blocks and the UTXO set all refer
+// to that canonical chain.
+type blockStore struct {
+	mu   sync.RWMutex
+	file *os.File
+	size int64
+	tree *blockTree
+	tip  *Block
+	utxo *UTXOSet
+
+	consensus     Consensus
+	reorgHandlers []func(ReorgEvent)
+}
+
+// openBlockStore opens (or creates) the store file at path, drops a torn tail
+// record if the previous run crashed mid-write and re-validates the chain,
+// checking every seal with engine.
+func openBlockStore(path string, engine Consensus) (*blockStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s := &blockStore{
+		file: f,
+		tree: newBlockTree(),
+		utxo: NewUTXOSet(),
+
+		consensus: engine,
+	}
+	if err := s.recover(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *blockStore) recover() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := info.Size()
+
+	var offset int64
+	for offset < fileSize {
+		block, n, err := readRecord(s.file, offset)
+		if errors.Is(err, errTornRecord) {
+			// Only the last record can have been cut short by a crash. A
+			// damaged length can make any record look like it runs past the
+			// end, so an intact record further on also means corruption.
+			if offset+n < fileSize || intactRecordAfter(s.file, offset, fileSize) {
+				return fmt.Errorf("%w: record at offset %d: %v", ErrInvalidChain, offset, err)
+			}
+			if err := s.file.Truncate(offset); err != nil {
+				return fmt.Errorf("truncate torn record at offset %d: %w", offset, err)
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read record at offset %d: %w", offset, err)
+		}
+		node, ev, err := s.connect(block)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidChain, err)
+		}
+		node.offset = offset
+		s.commit(node, block, ev)
+		offset += n
+	}
+	s.size = offset
+	return nil
+}
+
+// readRecord returns errTornRecord for a record that was not written out
+// completely, as opposed to one that was written but cannot be decoded. The
+// returned size is that of the record as its header claims, so the caller can
+// tell whether a torn record is the last one in the file.
+func readRecord(r io.ReaderAt, offset int64) (Block, int64, error) {
+	var block Block
+	header := make([]byte, recordHeaderSize)
+	if _, err := r.ReadAt(header, offset); err != nil {
+		return block, recordHeaderSize, tornOr(err)
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	sum := binary.BigEndian.Uint32(header[4:8])
+	size := recordHeaderSize + int64(length)
+	if length > maxRecordSize {
+		return block, size, fmt.Errorf("%w: record at offset %d: length %d exceeds limit", ErrInvalidChain, offset, length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := r.ReadAt(payload, offset+recordHeaderSize); err != nil {
+		return block, size, tornOr(err)
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return block, size, fmt.Errorf("%w: checksum mismatch", errTornRecord)
+	}
+	block, err := decodeBlock(payload)
+	if err != nil {
+		return block, 0, err
+	}
+	return block, recordHeaderSize + int64(length), nil
+}
+
+// intactRecordAfter reports whether a complete record with a matching
+// checksum starts anywhere after offset. It is only used once the record at
+// offset has turned out to be bad, to tell a torn tail from a damaged header.
+func intactRecordAfter(r io.ReaderAt, offset, fileSize int64) bool {
+	rest := make([]byte, fileSize-offset)
+	if _, err := r.ReadAt(rest, offset); err != nil {
+		return false
+	}
+	for i := 1; i+recordHeaderSize <= len(rest); i++ {
+		length := binary.BigEndian.Uint32(rest[i:])
+		end := i + recordHeaderSize + int(length)
+		if length == 0 || length > maxRecordSize || end > len(rest) {
+			continue
+		}
+		if crc32.ChecksumIEEE(rest[i+recordHeaderSize:end]) == binary.BigEndian.Uint32(rest[i+4:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func tornOr(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %v", errTornRecord, err)
+	}
+	return err
+}
+
+// connect checks block against the tree. If its branch becomes the heaviest
+// the UTXO set is moved onto it and the switch is returned; blocks on lighter
+// side chains have their spends checked only once their branch takes over.
+// The returned node is not added to the tree yet.
+func (s *blockStore) connect(block Block) (*treeNode, *ReorgEvent, error) {
+	if _, ok := s.tree.byHash[block.Hash]; ok {
+		return nil, nil, fmt.Errorf("block #%d %s is already stored", block.Index, block.Hash)
+	}
+	best := s.tree.best()
+	if best == nil {
+		if errs := genesisErrors(block); len(errs) > 0 {
+			return nil, nil, fmt.Errorf("bad genesis block: %v", errs[0])
+		}
+		node := &treeNode{hash: block.Hash, work: s.consensus.Work(block)}
+		return node, &ReorgEvent{Connected: []Block{block}}, s.utxo.ApplyBlock(block)
+	}
+	if block.Index == 0 {
+		return nil, nil, errors.New("store already has a genesis block")
+	}
+
+	parent, ok := s.tree.byHash[block.PreviousHash]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: block #%d", ErrUnknownParent, block.Index)
+	}
+	prev, err := s.read(parent)
+	if err != nil {
+		return nil, nil, err
+	}
+	if errs := linkErrors(s.consensus, prev, block); len(errs) > 0 {
+		return nil, nil, fmt.Errorf("block #%d is invalid: %v", block.Index, errs[0])
+	}
+	node := &treeNode{hash: block.Hash, index: block.Index, parent: parent, work: parent.work + s.consensus.Work(block)}
+	if node.work <= best.work {
+		return node, nil, nil
+	}
+
+	fork, disconnect, connect := s.tree.branch(parent)
+	if len(disconnect) > 0 {
+		canonical, err := s.blocks()
+		if err != nil {
+			return nil, nil, err
+		}
+		if final := s.consensus.Finalize(canonical); fork.index < final {
+			return nil, nil, fmt.Errorf("%w: block #%d", ErrFinalized, final)
+		}
+	}
+	ev := &ReorgEvent{}
+	if ev.Fork, err = s.read(fork); err != nil {
+		return nil, nil, err
+	}
+	if ev.Disconnected, err = s.readAll(disconnect); err != nil {
+		return nil, nil, err
+	}
+	if ev.Connected, err = s.readAll(connect); err != nil {
+		return nil, nil, err
+	}
+	ev.Connected = append(ev.Connected, block)
+	if err := s.utxo.Reorg(ev.Disconnected, ev.Connected); err != nil {
+		return nil, nil, err
+	}
+	return node, ev, nil
+}
+
+// commit adds a connected block to the tree and, if its branch took over,
+// makes it the tip.
+func (s *blockStore) commit(node *treeNode, block Block, ev *ReorgEvent) {
+	s.tree.add(node)
+	if ev != nil {
+		s.tree.setBest(node)
+		s.tip = &block
+	}
+}
+
+func (s *blockStore) read(n *treeNode) (Block, error) {
+	block, _, err := readRecord(s.file, n.offset)
+	return block, err
+}
+
+func (s *blockStore) readAll(nodes []*treeNode) ([]Block, error) {
+	blocks := make([]Block, 0, len(nodes))
+	for _, n := range nodes {
+		block, err := s.read(n)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// Append writes block to the end of the store and syncs it to disk. Its
+// parent must already be stored, but it need not be the tip: a block on a
+// side chain is kept, and becomes canonical once its branch carries more
+// work than the current one. Reorg handlers run after the switch.
+func (s *blockStore) Append(block Block) error {
+	ev, err := s.append(block)
+	if err != nil {
+		return err
+	}
+	if ev != nil && len(ev.Disconnected) > 0 {
+		s.mu.RLock()
+		handlers := s.reorgHandlers
+		s.mu.RUnlock()
+		for _, h := range handlers {
+			h(*ev)
+		}
+	}
+	return nil
+}
+
+func (s *blockStore) append(block Block) (*ReorgEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ev, err := s.connect(block)
+	if err != nil {
+		return nil, err
+	}
+	payload := encodeBlock(block)
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+
+	_, err = s.file.WriteAt(record, s.size)
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		if ev != nil {
+			s.utxo.Reorg(reversed(ev.Connected), reversed(ev.Disconnected))
+		}
+		return nil, err
+	}
+	node.offset = s.size
+	s.size += int64(len(record))
+	s.commit(node, block, ev)
+	return ev, nil
+}
+
+func reversed(blocks []Block) []Block {
+	r := make([]Block, len(blocks))
+	for i, b := range blocks {
+		r[len(blocks)-1-i] = b
+	}
+	return r
+}
+
+// OnReorg registers fn to be called whenever the canonical chain switches
+// branches, e.g. to roll back and replay state derived from the chain.
+func (s *blockStore) OnReorg(fn func(ReorgEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reorgHandlers = append(s.reorgHandlers, fn)
+}
+
+// UTXO is the unspent output set of the canonical chain. It is rolled back
+// and replayed whenever the store switches branches.
+func (s *blockStore) UTXO() *UTXOSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.utxo
+}
+
+// Tip returns the last block of the canonical chain, or false if the store is
+// empty.
+func (s *blockStore) Tip() (Block, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.tip == nil {
+		return Block{}, false
+	}
+	return *s.tip, true
+}
+
+// Len is the number of blocks in the canonical chain.
+func (s *blockStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.tree.canonical)
+}
+
+// Work is the cumulative work of the canonical chain.
+func (s *blockStore) Work() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if best := s.tree.best(); best != nil {
+		return best.work
+	}
+	return 0
+}
+
+// Tips lists the tip of every known branch, the canonical one first.
+func (s *blockStore) Tips() []ChainTip {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tree.chainTips()
+}
+
+func (s *blockStore) BlockByIndex(index int) (Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if index < 0 || index >= len(s.tree.canonical) {
+		return Block{}, ErrBlockNotFound
+	}
+	return s.read(s.tree.canonical[index])
+}
+
+// BlockByHash finds a block on any branch.
+func (s *blockStore) BlockByHash(hash string) (Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n, ok := s.tree.byHash[hash]
+	if !ok {
+		return Block{}, ErrBlockNotFound
+	}
+	return s.read(n)
+}
+
+// Blocks reads the canonical chain back from disk, genesis first.
+func (s *blockStore) Blocks() ([]Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.blocks()
+}
+
+func (s *blockStore) blocks() ([]Block, error) {
+	return s.readAll(s.tree.canonical)
+}
+
+func (s *blockStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
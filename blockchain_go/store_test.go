@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T, blocks int) (*blockStore, string) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	store, err := openBlockStore(path, testConsensus)
+	require.NoError(t, err)
+
+	prev, err := createGenesisBlock(store)
+	require.NoError(t, err)
+	alice, bob := testWallet(t), testWallet(t)
+	for i := 1; i < blocks; i++ {
+		var txs []Transaction
+		if i > 1 {
+			tx, err := NewTransaction(alice, bob.Address(), i, store.UTXO())
+			require.NoError(t, err)
+			txs = append(txs, tx)
+		}
+		prev, err = genesisBlock(store, prev, alice.Address(), txs)
+		require.NoError(t, err)
+	}
+	return store, path
+}
+
+func TestBlockStoreReopen(t *testing.T) {
+	store, path := newTestStore(t, 3)
+	tip, _ := store.Tip()
+	balance := store.UTXO().BalanceOf(tip.Transactions[0].Outputs[0].Address)
+	require.NoError(t, store.Close())
+
+	store, err := openBlockStore(path, testConsensus)
+	require.NoError(t, err)
+	defer store.Close()
+
+	assert.Equal(t, 3, store.Len())
+	reopenedTip, ok := store.Tip()
+	assert.True(t, ok)
+	assert.Equal(t, tip, reopenedTip)
+
+	assert.Equal(t, balance, store.UTXO().BalanceOf(tip.Transactions[0].Outputs[0].Address))
+
+	byHash, err := store.BlockByHash(tip.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, 2, byHash.Index)
+
+	_, err = store.BlockByIndex(7)
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+}
+
+func TestBlockStoreTruncatesTornTail(t *testing.T) {
+	store, path := newTestStore(t, 2)
+	require.NoError(t, store.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	goodSize := info.Size()
+
+	// Simulate a crash half way through writing the next record.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 90, 1, 2, 3, 4, '{', '"'})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	store, err = openBlockStore(path, testConsensus)
+	require.NoError(t, err)
+	defer store.Close()
+
+	assert.Equal(t, 2, store.Len())
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, goodSize, info.Size())
+
+	tip, _ := store.Tip()
+	_, err = genesisBlock(store, tip, "miner", nil)
+	assert.NoError(t, err)
+}
+
+func TestBlockStoreRejectsCorruptionBeforeTail(t *testing.T) {
+	store, path := newTestStore(t, 4)
+	require.NoError(t, store.Close())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	// Flip a payload byte of the genesis record: a damaged record followed by
+	// intact ones is not a crash mid-write and must not be cut off.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[recordHeaderSize+3] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = openBlockStore(path, testConsensus)
+	assert.ErrorIs(t, err, ErrInvalidChain)
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), after.Size())
+}
+
+func TestBlockStoreRejectsDamagedLengthBeforeTail(t *testing.T) {
+	store, path := newTestStore(t, 4)
+	require.NoError(t, store.Close())
+
+	// A damaged length makes the genesis record claim to run past the end of
+	// the file, just like a torn tail would.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = openBlockStore(path, testConsensus)
+	assert.ErrorIs(t, err, ErrInvalidChain)
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, data, after)
+
+	data[0] = 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	_, err = openBlockStore(path, testConsensus)
+	assert.ErrorIs(t, err, ErrInvalidChain, "a length above the limit is never a torn write")
+}
+
+func TestBlockStoreRejectsTamperedChain(t *testing.T) {
+	store, _ := newTestStore(t, 1)
+	defer store.Close()
+
+	genesis, _ := store.Tip()
+	next := Block{Index: 1, PreviousHash: "not-the-genesis-hash", MerkleRoot: calculateMerkleRoot(nil)}
+	next.Hash = calculateHash(next)
+	assert.Error(t, store.Append(next))
+	assert.Equal(t, 1, store.Len())
+
+	_, err := genesisBlock(store, genesis, "miner", nil)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"revisitgo/blockchain_go/codec"
+	"revisitgo/blockchain_go/merkle"
+	"revisitgo/blockchain_go/wallet"
+)
+
+// blockReward is what the coinbase transaction of every block pays its miner,
+// on top of the fees of the transactions it includes.
+const blockReward = 50
+
+// TxInput spends output Vout of the transaction TxID. In a coinbase
+// transaction TxID is empty and Vout carries the block height, which keeps
+// coinbase IDs unique.
+type TxInput struct {
+	TxID string `json:"txid"`
+	Vout int    `json:"vout"`
+}
+
+type TxOutput struct {
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+}
+
+// Transaction spends outputs owned by the address of PublicKey and creates new
+// ones. Signature covers everything except itself.
+type Transaction struct {
+	Inputs    []TxInput  `json:"inputs"`
+	Outputs   []TxOutput `json:"outputs"`
+	PublicKey []byte     `json:"public_key,omitempty"`
+	Signature []byte     `json:"signature,omitempty"`
+}
+
+// NewCoinbase pays the block reward plus fees to miner.
+func NewCoinbase(miner string, height, fees int) Transaction {
+	return Transaction{
+		Inputs:  []TxInput{{Vout: height}},
+		Outputs: []TxOutput{{Address: miner, Amount: blockReward + fees}},
+	}
+}
+
+// NewTransaction pays amount from the sender's unspent outputs to the address
+// to, sending any change back to the sender, and signs the result.
+func NewTransaction(from *wallet.Wallet, to string, amount int, utxo *UTXOSet) (Transaction, error) {
+	if amount <= 0 {
+		return Transaction{}, fmt.Errorf("amount must be positive, got %d", amount)
+	}
+	inputs, total, err := utxo.Select(from.Address(), amount)
+	if err != nil {
+		return Transaction{}, err
+	}
+	tx := Transaction{
+		Inputs:    inputs,
+		Outputs:   []TxOutput{{Address: to, Amount: amount}},
+		PublicKey: from.PublicKey,
+	}
+	if change := total - amount; change > 0 {
+		tx.Outputs = append(tx.Outputs, TxOutput{Address: from.Address(), Amount: change})
+	}
+	tx.Signature = from.Sign(tx.signingBytes())
+	return tx, nil
+}
+
+func (tx Transaction) IsCoinbase() bool {
+	return len(tx.Inputs) == 1 && tx.Inputs[0].TxID == "" && len(tx.PublicKey) == 0
+}
+
+// Sender is the address whose outputs tx spends.
+func (tx Transaction) Sender() string {
+	if tx.IsCoinbase() {
+		return "coinbase"
+	}
+	return wallet.Address(tx.PublicKey)
+}
+
+func (tx Transaction) String() string {
+	var sb strings.Builder
+	sb.WriteString(tx.Sender())
+	sb.WriteString(" ->")
+	for i, out := range tx.Outputs {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, " %s: %d", out.Address, out.Amount)
+	}
+	return sb.String()
+}
+
+func (tx Transaction) signingBytes() []byte {
+	var e codec.Encoder
+	writeUnsignedTransaction(&e, tx)
+	return e.Bytes()
+}
+
+// VerifySignature checks a regular transaction's signature. Coinbase
+// transactions are not signed.
+func (tx Transaction) VerifySignature() error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	return wallet.Verify(tx.Sender(), tx.PublicKey, tx.signingBytes(), tx.Signature)
+}
+
+func (tx Transaction) serialize() []byte {
+	var e codec.Encoder
+	writeTransaction(&e, tx)
+	return e.Bytes()
+}
+
+func (tx Transaction) ID() string {
+	sum := sha256.Sum256(tx.serialize())
+	return hex.EncodeToString(sum[:])
+}
+
+func merkleTree(txs []Transaction) *merkle.Tree {
+	return merkle.Build(txs, Transaction.serialize)
+}
+
+func calculateMerkleRoot(txs []Transaction) string {
+	return merkleTree(txs).RootHex()
+}
+
+// TransactionProof returns the inclusion proof for the i-th transaction in block.
+func TransactionProof(block Block, i int) (merkle.Proof, error) {
+	return merkleTree(block.Transactions).Proof(i)
+}
+
+// VerifyTransaction lets a light client that only holds a block header check
+// that tx is part of the block.
+func VerifyTransaction(merkleRoot string, tx Transaction, proof merkle.Proof) bool {
+	return merkle.VerifyHex(merkleRoot, tx.serialize(), proof)
+}
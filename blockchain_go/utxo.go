@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownOutput     = errors.New("input spends an unknown output")
+	ErrDoubleSpend       = errors.New("output already spent")
+	ErrNotOwner          = errors.New("input spends an output owned by someone else")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrBadCoinbase       = errors.New("invalid coinbase transaction")
+	ErrAmountOverflow    = errors.New("amount exceeds the money supply")
+)
+
+// maxMoney bounds every amount and every sum of amounts the chain accepts. It
+// is far above anything the block reward can mint, and low enough that adding
+// two bounded amounts can never overflow an int.
+const maxMoney = 1 << 50
+
+// addAmount returns a+b, or ErrAmountOverflow if the sum passes maxMoney.
+func addAmount(a, b int) (int, error) {
+	if b > maxMoney || a > maxMoney-b {
+		return 0, fmt.Errorf("%w: %d + %d", ErrAmountOverflow, a, b)
+	}
+	return a + b, nil
+}
+
+// Outpoint identifies one output of one transaction.
+type Outpoint struct {
+	TxID string
+	Vout int
+}
+
+// UTXOSet holds every unspent output of the chain, indexed by owner so
+// balances and coin selection never have to rescan the blocks. Spent outputs
+// are remembered so spending one again is reported as a double spend.
+type UTXOSet struct {
+	mu        sync.RWMutex
+	outputs   map[Outpoint]TxOutput
+	spent     map[Outpoint]TxOutput
+	byAddress map[string]map[Outpoint]struct{}
+	balances  map[string]int
+}
+
+func NewUTXOSet() *UTXOSet {
+	return &UTXOSet{
+		outputs:   make(map[Outpoint]TxOutput),
+		spent:     make(map[Outpoint]TxOutput),
+		byAddress: make(map[string]map[Outpoint]struct{}),
+		balances:  make(map[string]int),
+	}
+}
+
+func (u *UTXOSet) BalanceOf(address string) int {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.balances[address]
+}
+
+// Select picks unspent outputs of address worth at least amount, oldest
+// outpoints first so the choice is deterministic.
+func (u *UTXOSet) Select(address string, amount int) ([]TxInput, int, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	owned := make([]Outpoint, 0, len(u.byAddress[address]))
+	for op := range u.byAddress[address] {
+		owned = append(owned, op)
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		if owned[i].TxID != owned[j].TxID {
+			return owned[i].TxID < owned[j].TxID
+		}
+		return owned[i].Vout < owned[j].Vout
+	})
+
+	var inputs []TxInput
+	total := 0
+	for _, op := range owned {
+		if total >= amount {
+			break
+		}
+		inputs = append(inputs, TxInput{TxID: op.TxID, Vout: op.Vout})
+		total += u.outputs[op].Amount
+	}
+	if total < amount {
+		return nil, 0, fmt.Errorf("%w: %s has %d, needs %d", ErrInsufficientFunds, address, total, amount)
+	}
+	return inputs, total, nil
+}
+
+// utxoView layers the effects of a block's transactions over the set without
+// touching it, so a block can be checked before anything is committed.
+type utxoView struct {
+	base    *UTXOSet
+	spent   map[Outpoint]bool
+	created map[Outpoint]TxOutput
+}
+
+func (v *utxoView) spend(op Outpoint) (TxOutput, error) {
+	if _, ok := v.base.spent[op]; ok || v.spent[op] {
+		return TxOutput{}, fmt.Errorf("%w: %s:%d", ErrDoubleSpend, op.TxID, op.Vout)
+	}
+	out, ok := v.created[op]
+	if !ok {
+		out, ok = v.base.outputs[op]
+	}
+	if !ok {
+		return TxOutput{}, fmt.Errorf("%w: %s:%d", ErrUnknownOutput, op.TxID, op.Vout)
+	}
+	v.spent[op] = true
+	return out, nil
+}
+
+// spendAll checks regular transactions in order, letting later ones spend
+// outputs created by earlier ones, and returns the total fee they pay.
+func (v *utxoView) spendAll(txs []Transaction) (int, error) {
+	fees := 0
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			return 0, fmt.Errorf("%w: coinbase must be the first transaction", ErrBadCoinbase)
+		}
+		if len(tx.Inputs) == 0 || len(tx.Outputs) == 0 {
+			return 0, fmt.Errorf("transaction %s has no inputs or no outputs", tx.ID())
+		}
+		in := 0
+		for _, input := range tx.Inputs {
+			out, err := v.spend(Outpoint(input))
+			if err != nil {
+				return 0, err
+			}
+			if out.Address != tx.Sender() {
+				return 0, fmt.Errorf("%w: %s:%d", ErrNotOwner, input.TxID, input.Vout)
+			}
+			if in, err = addAmount(in, out.Amount); err != nil {
+				return 0, err
+			}
+		}
+		out, err := outputTotal(tx)
+		if err != nil {
+			return 0, err
+		}
+		if out > in {
+			return 0, fmt.Errorf("%w: transaction %s spends %d but only has %d", ErrInsufficientFunds, tx.ID(), out, in)
+		}
+		if fees, err = addAmount(fees, in-out); err != nil {
+			return 0, err
+		}
+		id := tx.ID()
+		for i, output := range tx.Outputs {
+			v.created[Outpoint{TxID: id, Vout: i}] = output
+		}
+	}
+	return fees, nil
+}
+
+func outputTotal(tx Transaction) (int, error) {
+	total := 0
+	for _, out := range tx.Outputs {
+		if out.Amount <= 0 {
+			return 0, fmt.Errorf("transaction %s has a non-positive output", tx.ID())
+		}
+		var err error
+		if total, err = addAmount(total, out.Amount); err != nil {
+			return 0, fmt.Errorf("transaction %s: %w", tx.ID(), err)
+		}
+	}
+	return total, nil
+}
+
+func (u *UTXOSet) view() *utxoView {
+	return &utxoView{base: u, spent: make(map[Outpoint]bool), created: make(map[Outpoint]TxOutput)}
+}
+
+// Fees returns the total fee paid by txs, which must not include a coinbase.
+func (u *UTXOSet) Fees(txs []Transaction) (int, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.view().spendAll(txs)
+}
+
+// CheckBlock reports whether block can be applied: every block after genesis
+// starts with a coinbase paying at most the reward plus fees, and every other
+// transaction spends existing outputs of its sender exactly once.
+func (u *UTXOSet) CheckBlock(block Block) error {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.checkBlock(block)
+}
+
+func (u *UTXOSet) checkBlock(block Block) error {
+	txs := block.Transactions
+	if len(txs) == 0 {
+		if block.Index == 0 {
+			return nil
+		}
+		return fmt.Errorf("%w: block #%d has no coinbase", ErrBadCoinbase, block.Index)
+	}
+	coinbase := txs[0]
+	if !coinbase.IsCoinbase() || coinbase.Inputs[0].Vout != block.Index || len(coinbase.Outputs) != 1 {
+		return fmt.Errorf("%w: block #%d", ErrBadCoinbase, block.Index)
+	}
+	reward, err := outputTotal(coinbase)
+	if err != nil {
+		return err
+	}
+	fees, err := u.view().spendAll(txs[1:])
+	if err != nil {
+		return err
+	}
+	allowed, err := addAmount(blockReward, fees)
+	if err != nil {
+		return err
+	}
+	if reward > allowed {
+		return fmt.Errorf("%w: pays %d, allowed %d", ErrBadCoinbase, reward, allowed)
+	}
+	return nil
+}
+
+// ApplyBlock checks block and, if it is valid, spends its inputs and adds its
+// outputs to the set.
+func (u *UTXOSet) ApplyBlock(block Block) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.applyBlock(block)
+}
+
+func (u *UTXOSet) applyBlock(block Block) error {
+	if err := u.checkBlock(block); err != nil {
+		return err
+	}
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				u.remove(Outpoint(in))
+			}
+		}
+		id := tx.ID()
+		for i, out := range tx.Outputs {
+			u.add(Outpoint{TxID: id, Vout: i}, out)
+		}
+	}
+	return nil
+}
+
+// Reorg moves the set from one branch to another: the disconnected blocks,
+// tip first, are rolled back and the connected ones, oldest first, applied.
+// If a connected block does not apply the set is left as it was.
+func (u *UTXOSet) Reorg(disconnected, connected []Block) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, block := range disconnected {
+		u.undoBlock(block)
+	}
+	for i, block := range connected {
+		if err := u.applyBlock(block); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				u.undoBlock(connected[j])
+			}
+			for j := len(disconnected) - 1; j >= 0; j-- {
+				u.applyBlock(disconnected[j])
+			}
+			return fmt.Errorf("block #%d: %w", block.Index, err)
+		}
+	}
+	return nil
+}
+
+// undoBlock reverses applyBlock for the last block applied: its outputs are
+// dropped and the outputs it spent become unspent again.
+func (u *UTXOSet) undoBlock(block Block) {
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		id := tx.ID()
+		for vout := range tx.Outputs {
+			u.drop(Outpoint{TxID: id, Vout: vout})
+		}
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			op := Outpoint(in)
+			out := u.spent[op]
+			delete(u.spent, op)
+			u.add(op, out)
+		}
+	}
+}
+
+func (u *UTXOSet) add(op Outpoint, out TxOutput) {
+	u.outputs[op] = out
+	if u.byAddress[out.Address] == nil {
+		u.byAddress[out.Address] = make(map[Outpoint]struct{})
+	}
+	u.byAddress[out.Address][op] = struct{}{}
+	u.balances[out.Address] += out.Amount
+}
+
+// remove spends op.
+func (u *UTXOSet) remove(op Outpoint) {
+	u.spent[op] = u.outputs[op]
+	u.drop(op)
+}
+
+// drop forgets op without recording it as spent.
+func (u *UTXOSet) drop(op Outpoint) {
+	out, ok := u.outputs[op]
+	if !ok {
+		return
+	}
+	delete(u.outputs, op)
+	delete(u.byAddress[out.Address], op)
+	if len(u.byAddress[out.Address]) == 0 {
+		delete(u.byAddress, out.Address)
+	}
+	u.balances[out.Address] -= out.Amount
+	if u.balances[out.Address] == 0 {
+		delete(u.balances, out.Address)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUTXOSetTracksBalances(t *testing.T) {
+	alice, bob, miner := testWallet(t), testWallet(t), testWallet(t)
+	utxo := NewUTXOSet()
+	genesis := Block{MerkleRoot: calculateMerkleRoot(nil)}
+	require.NoError(t, utxo.ApplyBlock(genesis))
+
+	block1 := sealBlock(genesis, []Transaction{NewCoinbase(alice.Address(), 1, 0)})
+	require.NoError(t, utxo.ApplyBlock(block1))
+	assert.Equal(t, blockReward, utxo.BalanceOf(alice.Address()))
+
+	// Alice pays Bob 20 and leaves 5 as a fee for the miner.
+	inputs, total, err := utxo.Select(alice.Address(), 25)
+	require.NoError(t, err)
+	pay := Transaction{
+		Inputs:    inputs,
+		Outputs:   []TxOutput{{Address: bob.Address(), Amount: 20}, {Address: alice.Address(), Amount: total - 25}},
+		PublicKey: alice.PublicKey,
+	}
+	pay.Signature = alice.Sign(pay.signingBytes())
+
+	fees, err := utxo.Fees([]Transaction{pay})
+	require.NoError(t, err)
+	assert.Equal(t, 5, fees)
+
+	block2 := sealBlock(block1, []Transaction{NewCoinbase(miner.Address(), 2, fees), pay})
+	require.NoError(t, utxo.ApplyBlock(block2))
+	assert.Equal(t, 25, utxo.BalanceOf(alice.Address()))
+	assert.Equal(t, 20, utxo.BalanceOf(bob.Address()))
+	assert.Equal(t, blockReward+5, utxo.BalanceOf(miner.Address()))
+
+	_, err = NewTransaction(bob, alice.Address(), 21, utxo)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+}
+
+func TestUTXOSetRejectsDoubleSpends(t *testing.T) {
+	alice, bob, carol := testWallet(t), testWallet(t), testWallet(t)
+	utxo := NewUTXOSet()
+	genesis := Block{MerkleRoot: calculateMerkleRoot(nil)}
+	block1 := sealBlock(genesis, []Transaction{NewCoinbase(alice.Address(), 1, 0)})
+	require.NoError(t, utxo.ApplyBlock(block1))
+
+	toBob, err := NewTransaction(alice, bob.Address(), 10, utxo)
+	require.NoError(t, err)
+	toCarol, err := NewTransaction(alice, carol.Address(), 10, utxo)
+	require.NoError(t, err)
+
+	sameBlock := sealBlock(block1, []Transaction{NewCoinbase(alice.Address(), 2, 0), toBob, toCarol})
+	assert.ErrorIs(t, utxo.CheckBlock(sameBlock), ErrDoubleSpend)
+
+	block2 := sealBlock(block1, []Transaction{NewCoinbase(alice.Address(), 2, 0), toBob})
+	require.NoError(t, utxo.ApplyBlock(block2))
+	block3 := sealBlock(block2, []Transaction{NewCoinbase(alice.Address(), 3, 0), toCarol})
+	assert.ErrorIs(t, utxo.ApplyBlock(block3), ErrDoubleSpend)
+	assert.Zero(t, utxo.BalanceOf(carol.Address()))
+}
+
+func TestUTXOSetRejectsBadCoinbase(t *testing.T) {
+	miner := testWallet(t)
+	utxo := NewUTXOSet()
+	genesis := Block{MerkleRoot: calculateMerkleRoot(nil)}
+
+	greedy := sealBlock(genesis, []Transaction{NewCoinbase(miner.Address(), 1, 1)})
+	assert.ErrorIs(t, utxo.CheckBlock(greedy), ErrBadCoinbase)
+
+	empty := sealBlock(genesis, nil)
+	assert.ErrorIs(t, utxo.CheckBlock(empty), ErrBadCoinbase)
+
+	wrongHeight := sealBlock(genesis, []Transaction{NewCoinbase(miner.Address(), 7, 0)})
+	assert.ErrorIs(t, utxo.CheckBlock(wrongHeight), ErrBadCoinbase)
+}
+
+func TestUTXOSetRejectsOverflowingAmounts(t *testing.T) {
+	alice, bob := testWallet(t), testWallet(t)
+	utxo := NewUTXOSet()
+	genesis := Block{MerkleRoot: calculateMerkleRoot(nil)}
+	block1 := sealBlock(genesis, []Transaction{NewCoinbase(alice.Address(), 1, 0)})
+	require.NoError(t, utxo.ApplyBlock(block1))
+
+	// {MaxInt, MaxInt, 2} wraps around to 0 and would pass as spending nothing.
+	inputs, _, err := utxo.Select(alice.Address(), 1)
+	require.NoError(t, err)
+	wrap := Transaction{
+		Inputs: inputs,
+		Outputs: []TxOutput{
+			{Address: bob.Address(), Amount: math.MaxInt},
+			{Address: bob.Address(), Amount: math.MaxInt},
+			{Address: bob.Address(), Amount: 2},
+		},
+		PublicKey: alice.PublicKey,
+	}
+	wrap.Signature = alice.Sign(wrap.signingBytes())
+
+	_, err = utxo.Fees([]Transaction{wrap})
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+
+	block2 := sealBlock(block1, []Transaction{NewCoinbase(alice.Address(), 2, 0), wrap})
+	assert.ErrorIs(t, utxo.CheckBlock(block2), ErrAmountOverflow)
+
+	rich := sealBlock(block1, []Transaction{NewCoinbase(alice.Address(), 2, maxMoney)})
+	assert.ErrorIs(t, utxo.CheckBlock(rich), ErrAmountOverflow)
+	assert.Equal(t, blockReward, utxo.BalanceOf(alice.Address()))
+}
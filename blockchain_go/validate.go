@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"revisitgo/blockchain_go/validation"
+)
+
+// Checks of the rules this chain adds to the shared ones.
+const (
+	CheckSignature validation.Check = "signature"
+	CheckSpend     validation.Check = "spend"
+	CheckSeal      validation.Check = "consensus seal"
+)
+
+// ValidateChain walks the whole chain, genesis included, and reports every
+// broken check instead of stopping at the first one. Spends are replayed
+// against a fresh UTXO set, so double spends and overdrafts are caught too,
+// and every block after genesis must carry a seal that engine accepts.
+func ValidateChain(blocks []Block, engine Consensus) validation.ChainReport {
+	report := validation.NewChainReport(len(blocks))
+	utxo := NewUTXOSet()
+	for i, block := range blocks {
+		var errs []validation.LinkError
+		if i == 0 {
+			errs = genesisErrors(block)
+		} else {
+			errs = linkErrors(engine, blocks[i-1], block)
+		}
+		if err := utxo.ApplyBlock(block); err != nil {
+			errs = append(errs, validation.LinkError{Check: CheckSpend, Expected: "only unspent outputs of the sender", Actual: err.Error()})
+		}
+		report.Add(i, errs)
+	}
+	return report
+}
+
+func genesisErrors(genesis Block) []validation.LinkError {
+	errs := validation.Genesis(genesis.Index, genesis.PreviousHash)
+	return append(errs, contentErrors(genesis)...)
+}
+
+func linkErrors(engine Consensus, prev, curr Block) []validation.LinkError {
+	errs := validation.Link(prev.Index, prev.Hash, curr.Index, curr.PreviousHash)
+	errs = append(errs, contentErrors(curr)...)
+	if err := engine.Validate(curr); err != nil {
+		errs = append(errs, validation.LinkError{Check: CheckSeal, Expected: "block sealed by the chain's consensus", Actual: err.Error()})
+	}
+	return errs
+}
+
+func contentErrors(block Block) []validation.LinkError {
+	var errs []validation.LinkError
+	for i, tx := range block.Transactions {
+		if err := tx.VerifySignature(); err != nil {
+			errs = append(errs, validation.LinkError{Check: CheckSignature, Expected: fmt.Sprintf("valid signature on tx %d", i), Actual: err.Error()})
+		}
+	}
+	if root := calculateMerkleRoot(block.Transactions); block.MerkleRoot != root {
+		errs = append(errs, validation.LinkError{Check: validation.CheckMerkleRoot, Expected: root, Actual: block.MerkleRoot})
+	}
+	if hash := calculateHash(block); block.Hash != hash {
+		errs = append(errs, validation.LinkError{Check: validation.CheckHash, Expected: hash, Actual: block.Hash})
+	}
+	return errs
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"revisitgo/blockchain_go/validation"
+	"revisitgo/blockchain_go/wallet"
+)
+
+func testWallet(t *testing.T) *wallet.Wallet {
+	w, err := wallet.New()
+	require.NoError(t, err)
+	return w
+}
+
+// testConsensus keeps the proof of work cheap enough for tests.
+var testConsensus = &ProofOfWork{bits: 4}
+
+func sealBlock(prev Block, txs []Transaction) Block {
+	block := Block{Index: prev.Index + 1, Timestamp: prev.Timestamp + 1, MerkleRoot: calculateMerkleRoot(txs), Transactions: txs, PreviousHash: prev.Hash}
+	testConsensus.Propose(&block)
+	return block
+}
+
+// buildChain returns n blocks. Alice mines every block and, from the second
+// block on, pays Bob a little more each time.
+func buildChain(t *testing.T, n int) []Block {
+	alice, bob := testWallet(t), testWallet(t)
+	utxo := NewUTXOSet()
+	genesis := Block{Index: 0, Timestamp: 0, MerkleRoot: calculateMerkleRoot(nil)}
+	genesis.Hash = calculateHash(genesis)
+	chain := []Block{genesis}
+	for i := 1; i < n; i++ {
+		txs := []Transaction{NewCoinbase(alice.Address(), i, 0)}
+		if i > 1 {
+			tx, err := NewTransaction(alice, bob.Address(), i, utxo)
+			require.NoError(t, err)
+			txs = append(txs, tx)
+		}
+		block := sealBlock(chain[i-1], txs)
+		require.NoError(t, utxo.ApplyBlock(block))
+		chain = append(chain, block)
+	}
+	return chain
+}
+
+func TestValidateChainValid(t *testing.T) {
+	report := ValidateChain(buildChain(t, 4), testConsensus)
+	assert.True(t, report.Valid(), report.String())
+	assert.Equal(t, -1, report.FirstInvalid)
+}
+
+func TestValidateChainReportsEveryBrokenCheck(t *testing.T) {
+	chain := buildChain(t, 4)
+	chain[3].Transactions[1].Outputs[0].Address = "mallory"
+
+	report := ValidateChain(chain, testConsensus)
+	assert.False(t, report.Valid())
+	assert.Equal(t, 3, report.FirstInvalid)
+	assert.Equal(t, []validation.LinkError{
+		{Position: 3, Check: CheckSignature, Expected: "valid signature on tx 1", Actual: "wallet: signature verification failed"},
+		{Position: 3, Check: validation.CheckMerkleRoot, Expected: calculateMerkleRoot(chain[3].Transactions), Actual: chain[3].MerkleRoot},
+	}, report.Errors)
+}
+
+func TestValidateChainReportsBrokenLink(t *testing.T) {
+	chain := buildChain(t, 3)
+	chain[1].PreviousHash = "bogus"
+	chain[1].Hash = calculateHash(chain[1])
+
+	report := ValidateChain(chain, testConsensus)
+	assert.Equal(t, 1, report.FirstInvalid)
+	assert.Contains(t, report.Errors, validation.LinkError{Position: 1, Check: validation.CheckPreviousHash, Expected: chain[0].Hash, Actual: "bogus"})
+	assert.Contains(t, report.Errors, validation.LinkError{Position: 2, Check: validation.CheckPreviousHash, Expected: chain[1].Hash, Actual: chain[2].PreviousHash})
+}
+
+func TestValidateChainChecksGenesis(t *testing.T) {
+	chain := buildChain(t, 2)
+	chain[0].Index = 1
+
+	report := ValidateChain(chain, testConsensus)
+	assert.Equal(t, 0, report.FirstInvalid)
+	assert.Equal(t, validation.CheckIndex, report.Errors[0].Check)
+}
+
+func TestTransactionInclusionProof(t *testing.T) {
+	chain := buildChain(t, 3)
+	block := chain[2]
+
+	proof, err := TransactionProof(block, 1)
+	assert.NoError(t, err)
+	assert.True(t, VerifyTransaction(block.MerkleRoot, block.Transactions[1], proof))
+
+	forged := block.Transactions[1]
+	forged.Outputs = []TxOutput{{Address: "mallory", Amount: 300}}
+	assert.False(t, VerifyTransaction(block.MerkleRoot, forged, proof))
+}
+
+func TestValidateChainRejectsSpendingSomeoneElsesOutput(t *testing.T) {
+	chain := buildChain(t, 2)
+	mallory := testWallet(t)
+	aliceCoinbase := chain[1].Transactions[0]
+
+	// Mallory signs correctly with her own key, but the output is Alice's.
+	theft := Transaction{
+		Inputs:    []TxInput{{TxID: aliceCoinbase.ID(), Vout: 0}},
+		Outputs:   []TxOutput{{Address: mallory.Address(), Amount: blockReward}},
+		PublicKey: mallory.PublicKey,
+	}
+	theft.Signature = mallory.Sign(theft.signingBytes())
+	block := sealBlock(chain[1], []Transaction{NewCoinbase(mallory.Address(), 2, 0), theft})
+
+	report := ValidateChain(append(chain, block), testConsensus)
+	assert.Equal(t, 2, report.FirstInvalid)
+	assert.Equal(t, CheckSpend, report.Errors[0].Check)
+	assert.Contains(t, report.Errors[0].Actual, ErrNotOwner.Error())
+}
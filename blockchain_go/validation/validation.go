@@ -0,0 +1,101 @@
+// Package validation holds the report a full chain check produces, shared by
+// every chain implementation so that tools can read them the same way.
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Check names the rule a block broke. The checks below apply to every chain;
+// each chain adds its own for the rules of its consensus.
+type Check string
+
+const (
+	CheckIndex        Check = "index"
+	CheckPreviousHash Check = "previous hash"
+	CheckMerkleRoot   Check = "merkle root"
+	CheckHash         Check = "recomputed hash"
+)
+
+// LinkError describes one failed check for the block at Position in the chain.
+type LinkError struct {
+	Position int    `json:"position"`
+	Check    Check  `json:"check"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+func (e LinkError) Error() string {
+	return fmt.Sprintf("block at position %d: %s mismatch: expected %q, got %q", e.Position, e.Check, e.Expected, e.Actual)
+}
+
+// Genesis checks that a genesis block with index and previousHash starts the
+// chain.
+func Genesis(index int, previousHash string) []LinkError {
+	var errs []LinkError
+	if index != 0 {
+		errs = append(errs, LinkError{Check: CheckIndex, Expected: "0", Actual: fmt.Sprint(index)})
+	}
+	if previousHash != "" {
+		errs = append(errs, LinkError{Check: CheckPreviousHash, Expected: "", Actual: previousHash})
+	}
+	return errs
+}
+
+// Link checks that a block with index and previousHash directly follows the
+// block at prevIndex whose hash is prevHash.
+func Link(prevIndex int, prevHash string, index int, previousHash string) []LinkError {
+	var errs []LinkError
+	if index != prevIndex+1 {
+		errs = append(errs, LinkError{Check: CheckIndex, Expected: fmt.Sprint(prevIndex + 1), Actual: fmt.Sprint(index)})
+	}
+	if previousHash != prevHash {
+		errs = append(errs, LinkError{Check: CheckPreviousHash, Expected: prevHash, Actual: previousHash})
+	}
+	return errs
+}
+
+// ChainReport is the result of validating a whole chain. FirstInvalid is the
+// position of the first block that can no longer be trusted, or -1 if the
+// chain is valid.
+type ChainReport struct {
+	Length       int         `json:"length"`
+	Errors       []LinkError `json:"errors"`
+	FirstInvalid int         `json:"first_invalid"`
+}
+
+// NewChainReport returns the report for a chain of length blocks, valid until
+// errors are added.
+func NewChainReport(length int) ChainReport {
+	return ChainReport{Length: length, FirstInvalid: -1}
+}
+
+// Add records the errors found in the block at position, which must be added
+// in chain order.
+func (r *ChainReport) Add(position int, errs []LinkError) {
+	for i := range errs {
+		errs[i].Position = position
+	}
+	if len(errs) > 0 && r.FirstInvalid == -1 {
+		r.FirstInvalid = position
+	}
+	r.Errors = append(r.Errors, errs...)
+}
+
+func (r ChainReport) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+func (r ChainReport) String() string {
+	if r.Valid() {
+		return fmt.Sprintf("chain of %d blocks is valid", r.Length)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "chain of %d blocks is untrustworthy from position %d:", r.Length, r.FirstInvalid)
+	for _, e := range r.Errors {
+		sb.WriteString("\n  - ")
+		sb.WriteString(e.Error())
+	}
+	return sb.String()
+}
@@ -0,0 +1,33 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainReportKeepsFirstInvalidPosition(t *testing.T) {
+	report := NewChainReport(3)
+	report.Add(0, Genesis(0, ""))
+	assert.True(t, report.Valid())
+	assert.Equal(t, "chain of 3 blocks is valid", report.String())
+
+	report.Add(1, Link(0, "aa", 2, "bb"))
+	report.Add(2, Link(1, "cc", 2, "cc"))
+	report.Add(2, []LinkError{{Check: CheckHash, Expected: "dd", Actual: "ee"}})
+	assert.False(t, report.Valid())
+	assert.Equal(t, 1, report.FirstInvalid)
+	assert.Equal(t, []LinkError{
+		{Position: 1, Check: CheckIndex, Expected: "1", Actual: "2"},
+		{Position: 1, Check: CheckPreviousHash, Expected: "aa", Actual: "bb"},
+		{Position: 2, Check: CheckHash, Expected: "dd", Actual: "ee"},
+	}, report.Errors)
+	assert.Contains(t, report.String(), "untrustworthy from position 1")
+}
+
+func TestGenesisMustStartTheChain(t *testing.T) {
+	assert.Equal(t, []LinkError{
+		{Check: CheckIndex, Expected: "0", Actual: "4"},
+		{Check: CheckPreviousHash, Expected: "", Actual: "aa"},
+	}, Genesis(4, "aa"))
+}
@@ -0,0 +1,68 @@
+// Package wallet holds ed25519 keypairs and derives the addresses that
+// transactions are sent from and to.
+package wallet
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// addressLen is the number of bytes of the public key hash kept in an address.
+const addressLen = 20
+
+var ErrInvalidPublicKey = errors.New("wallet: invalid public key")
+
+type Wallet struct {
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// New generates a fresh keypair.
+func New() (*Wallet, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{PrivateKey: priv, PublicKey: pub}, nil
+}
+
+// FromSeed rebuilds a wallet from a 32 byte seed, e.g. one loaded from disk.
+func FromSeed(seed []byte) (*Wallet, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("wallet: seed must be 32 bytes")
+	}
+	priv := ed25519.NewKeyFromSeed(seed)
+	return &Wallet{PrivateKey: priv, PublicKey: priv.Public().(ed25519.PublicKey)}, nil
+}
+
+func (w *Wallet) Address() string {
+	return Address(w.PublicKey)
+}
+
+func (w *Wallet) Sign(message []byte) []byte {
+	return ed25519.Sign(w.PrivateKey, message)
+}
+
+// Address is the hex encoded, truncated SHA-256 of the public key.
+func Address(pub []byte) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:addressLen])
+}
+
+// Verify checks that sig is a signature of message by pub and that pub
+// belongs to address.
+func Verify(address string, pub, message, sig []byte) error {
+	if len(pub) != ed25519.PublicKeySize {
+		return ErrInvalidPublicKey
+	}
+	if Address(pub) != address {
+		return errors.New("wallet: public key does not match address")
+	}
+	if !ed25519.Verify(pub, message, sig) {
+		return errors.New("wallet: signature verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package wallet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	w, err := New()
+	require.NoError(t, err)
+	msg := []byte("send 1 BTC to bob")
+	sig := w.Sign(msg)
+
+	assert.NoError(t, Verify(w.Address(), w.PublicKey, msg, sig))
+	assert.Error(t, Verify(w.Address(), w.PublicKey, []byte("send 9 BTC to bob"), sig))
+
+	other, err := New()
+	require.NoError(t, err)
+	assert.Error(t, Verify(other.Address(), w.PublicKey, msg, sig))
+	assert.ErrorIs(t, Verify(w.Address(), w.PublicKey[:5], msg, sig), ErrInvalidPublicKey)
+}
+
+func TestFromSeedIsDeterministic(t *testing.T) {
+	seed := bytes.Repeat([]byte{7}, 32)
+	a, err := FromSeed(seed)
+	require.NoError(t, err)
+	b, err := FromSeed(seed)
+	require.NoError(t, err)
+	assert.Equal(t, a.Address(), b.Address())
+	assert.Len(t, a.Address(), 2*addressLen)
+
+	_, err = FromSeed(seed[:10])
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package channels
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noLeaks fails the test if it ends with more goroutines than it started
+// with. Tests using it must not run in parallel.
+func noLeaks(t *testing.T) {
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		// Polled by hand: assert.Eventually runs goroutines of its own.
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.LessOrEqual(t, runtime.NumGoroutine(), before, "leaked goroutines")
+	})
+}
+
+func gen[T any](vs ...T) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for _, v := range vs {
+			ch <- v
+		}
+	}()
+	return ch
+}
+
+// endless sends v until ctx is done.
+func endless[T any](ctx context.Context, v T) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for send(ctx, ch, v) {
+		}
+	}()
+	return ch
+}
+
+func collect[T any](ch <-chan T) []T {
+	var out []T
+	for v := range ch {
+		out = append(out, v)
+	}
+	return out
+}
+
+func TestOrDone(t *testing.T) {
+	noLeaks(t)
+	assert.Equal(t, []int{1, 2, 3}, collect(OrDone(context.Background(), gen(1, 2, 3))))
+
+	// A channel that is never closed is given up on when ctx is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	never := make(chan int)
+	out := OrDone(ctx, never)
+	cancel()
+	assert.Empty(t, collect(out))
+}
+
+func TestMerge(t *testing.T) {
+	noLeaks(t)
+	got := collect(Merge(context.Background(), gen(1, 2, 3), gen(4, 5), gen[int](), gen(6)))
+	sort.Ints(got)
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6}, got)
+	assert.Empty(t, collect(Merge[int](context.Background())))
+}
+
+func TestMergeStopsOnCancel(t *testing.T) {
+	noLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	out := Merge(ctx, endless(ctx, 1), endless(ctx, 2))
+	<-out
+	<-out
+	cancel()
+	collect(out)
+}
+
+func TestTee(t *testing.T) {
+	noLeaks(t)
+	a, b := Tee(context.Background(), gen(1, 2, 3))
+
+	// Read b first to show the outputs do not depend on read order.
+	var wg sync.WaitGroup
+	var gotA []int
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(5 * time.Millisecond)
+		gotA = collect(a)
+	}()
+	assert.Equal(t, []int{1, 2, 3}, collect(b))
+	wg.Wait()
+	assert.Equal(t, []int{1, 2, 3}, gotA)
+}
+
+func TestBroadcastStopsOnCancel(t *testing.T) {
+	noLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	outs := Broadcast(ctx, endless(ctx, "x"), 3)
+	require.Len(t, outs, 3)
+	assert.Equal(t, "x", <-outs[2])
+	// Nobody reads outs[0] or outs[1]; cancelling must still free everything.
+	cancel()
+	for _, out := range outs {
+		collect(out)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	noLeaks(t)
+	got := collect(Batch(context.Background(), gen(1, 2, 3, 4, 5, 6, 7), 3, 0))
+	assert.Equal(t, [][]int{{1, 2, 3}, {4, 5, 6}, {7}}, got)
+}
+
+func TestBatchFlushesAfterMaxWait(t *testing.T) {
+	noLeaks(t)
+	in := make(chan int)
+	out := Batch(context.Background(), in, 10, 20*time.Millisecond)
+
+	start := time.Now()
+	in <- 1
+	in <- 2
+	assert.Equal(t, []int{1, 2}, <-out)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	in <- 3
+	close(in)
+	assert.Equal(t, []int{3}, <-out)
+	_, ok := <-out
+	assert.False(t, ok)
+}
+
+func TestBatchStopsOnCancel(t *testing.T) {
+	noLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	out := Batch(ctx, endless(ctx, 1), 4, time.Millisecond)
+	assert.NotEmpty(t, <-out)
+	cancel()
+	collect(out)
+}
+
+func TestBridge(t *testing.T) {
+	noLeaks(t)
+	chans := make(chan (<-chan int))
+	go func() {
+		defer close(chans)
+		chans <- gen(1, 2)
+		chans <- gen[int]()
+		chans <- gen(3)
+	}()
+	assert.Equal(t, []int{1, 2, 3}, collect(Bridge(context.Background(), chans)))
+}
+
+func TestBridgeStopsOnCancel(t *testing.T) {
+	noLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	chans := make(chan (<-chan int), 1)
+	chans <- endless(ctx, 7)
+	out := Bridge(ctx, chans)
+	assert.Equal(t, 7, <-out)
+	cancel()
+	collect(out)
+}
@@ -1,34 +1,47 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"sync"
 	"time"
 )
 
-func longRunningTask(id int, done <-chan struct{}) {
+// longRunningTask reports progress every 500ms until ctx is cancelled.
+func longRunningTask(ctx context.Context, id int) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-done:
-			fmt.Printf("Goroutine %d received done signal. Exiting.\n", id)
+		case <-ctx.Done():
+			fmt.Printf("Goroutine %d stopping: %v\n", id, context.Cause(ctx))
 			return
-		default:
+		case <-ticker.C:
 			fmt.Printf("Goroutine %d is working...\n", id)
-			time.Sleep(500 * time.Millisecond)
 		}
 	}
 }
 
 func main() {
-	done := make(chan struct{})
+	// Stop after two seconds, or earlier on Ctrl-C.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
 
-	go longRunningTask(1, done)
-	go longRunningTask(2, done)
-
-	time.Sleep(2 * time.Second)
-
-	fmt.Println("Main: Sending done signal...")
-	close(done)
+	var wg sync.WaitGroup
+	for id := 1; id <= 2; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			longRunningTask(ctx, id)
+		}()
+	}
 
-	time.Sleep(1 * time.Second)
+	<-ctx.Done()
+	fmt.Println("Main: waiting for goroutines to stop...")
+	wg.Wait()
 	fmt.Println("Main: Exiting")
 }
@@ -0,0 +1,197 @@
+package durablequeue
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	kindEnqueue byte = 1
+	kindAck     byte = 2
+	// kindNextID heads a compacted log and carries the id the next enqueue
+	// gets, since the records that raised it may have been compacted away.
+	kindNextID byte = 3
+
+	// A record is a CRC-32 of the rest of it, then kind, id and payload
+	// length, then the payload.
+	headerSize = 4 + 1 + 8 + 4
+	maxPayload = 64 << 20
+)
+
+type record struct {
+	kind    byte
+	id      uint64
+	payload []byte
+}
+
+func (r record) encode() []byte {
+	buf := make([]byte, headerSize+len(r.payload))
+	buf[4] = r.kind
+	binary.BigEndian.PutUint64(buf[5:], r.id)
+	binary.BigEndian.PutUint32(buf[13:], uint32(len(r.payload)))
+	copy(buf[headerSize:], r.payload)
+	binary.BigEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+var (
+	errTorn      = errors.New("torn record")
+	errBadLength = errors.New("record length exceeds limit")
+)
+
+// readRecord reads the next record, returning io.EOF at a clean end of the
+// log, errBadLength for a length no append could have written, and errTorn
+// for a record that was only partly written or is corrupt.
+// The size returned for a torn record is the size its header claims, so the
+// caller can tell whether it reaches the end of the file.
+func readRecord(r io.Reader) (record, int64, error) {
+	header := make([]byte, headerSize)
+	if n, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return record{}, 0, io.EOF
+		}
+		return record{}, int64(n), errTorn
+	}
+	size := binary.BigEndian.Uint32(header[13:])
+	if size > maxPayload {
+		return record{}, headerSize + int64(size), errBadLength
+	}
+	buf := make([]byte, headerSize+int(size))
+	copy(buf, header)
+	if _, err := io.ReadFull(r, buf[headerSize:]); err != nil {
+		return record{}, int64(len(buf)), errTorn
+	}
+	if crc32.ChecksumIEEE(buf[4:]) != binary.BigEndian.Uint32(buf) {
+		return record{}, int64(len(buf)), errTorn
+	}
+	return record{
+		kind:    buf[4],
+		id:      binary.BigEndian.Uint64(buf[5:]),
+		payload: buf[headerSize:],
+	}, int64(len(buf)), nil
+}
+
+// intactRecordAfter reports whether a complete record with a matching
+// checksum starts anywhere after offset. It is only used once the record at
+// offset has turned out to be bad, to tell a torn tail from a damaged header.
+func intactRecordAfter(r io.ReaderAt, offset, fileSize int64) bool {
+	rest := make([]byte, fileSize-offset)
+	if _, err := r.ReadAt(rest, offset); err != nil {
+		return false
+	}
+	for i := 1; i+headerSize <= len(rest); i++ {
+		kind := rest[i+4]
+		size := binary.BigEndian.Uint32(rest[i+13:])
+		end := i + headerSize + int(size)
+		if kind < kindEnqueue || kind > kindNextID || size > maxPayload || end > len(rest) {
+			continue
+		}
+		if crc32.ChecksumIEEE(rest[i+4:end]) == binary.BigEndian.Uint32(rest[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// logFile is an append-only file of records, synced after every append.
+type logFile struct {
+	f *os.File
+}
+
+// openLog replays every intact record of the log at path through replay. A
+// torn record at the end, left by a crash halfway through an append, is cut
+// off. A bad record with more of the log after it cannot come from a crash,
+// so it is reported as ErrCorrupt and the file is left alone.
+func openLog(path string, replay func(record) error) (*logFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		rec, n, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err == errTorn || err == errBadLength {
+			// Only the last append can have been cut short by a crash. A
+			// damaged length can make any record look like it runs past the
+			// end, so an intact record further on also means corruption.
+			if err == errBadLength || offset+n < info.Size() || intactRecordAfter(f, offset, info.Size()) {
+				f.Close()
+				return nil, fmt.Errorf("%w: %s: bad record at offset %d", ErrCorrupt, path, offset)
+			}
+			break
+		}
+		if err := replay(rec); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s at offset %d: %w", path, offset, err)
+		}
+		offset += n
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &logFile{f: f}, nil
+}
+
+func (l *logFile) append(r record) error {
+	if _, err := l.f.Write(r.encode()); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+func (l *logFile) Close() error {
+	return l.f.Close()
+}
+
+// rewriteLog replaces the log at path with one holding only records. The new
+// log is written beside the old one and renamed over it, so a crash leaves
+// one or the other intact. old is closed once the new log is in place.
+func rewriteLog(path string, old *logFile, records []record) (*logFile, error) {
+	tmp := path + ".compact"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	for _, r := range records {
+		w.Write(r.encode())
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	old.Close()
+	return &logFile{f: f}, nil
+}
@@ -0,0 +1,284 @@
+// Package durablequeue is a job queue that survives restarts. Every enqueue
+// and ack is appended to a write-ahead log and synced before it returns; on
+// open the log is replayed and every message that was never acked is
+// delivered again. A message that is not acked within the visibility timeout
+// of being handed out is delivered again as well.
+package durablequeue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrClosed     = errors.New("durablequeue: queue is closed")
+	ErrUnknownID  = errors.New("durablequeue: unknown message")
+	ErrNotPending = errors.New("durablequeue: message was not handed out")
+	ErrTooLarge   = errors.New("durablequeue: payload too large")
+	ErrCorrupt    = errors.New("durablequeue: log is corrupt")
+)
+
+// Message is a queued payload. Deliveries counts how often it has been
+// handed out since the queue was opened, this time included.
+type Message struct {
+	ID         uint64
+	Payload    []byte
+	Deliveries int
+}
+
+type Option func(*Queue)
+
+// WithVisibilityTimeout sets how long a handed out message may go unacked
+// before it is delivered again. The default is 30 seconds.
+func WithVisibilityTimeout(d time.Duration) Option {
+	return func(q *Queue) { q.visibility = d }
+}
+
+// WithCompactEvery compacts the log after every n acks. The default is 1000;
+// 0 leaves compaction to explicit Compact calls.
+func WithCompactEvery(n int) Option {
+	return func(q *Queue) { q.compactEvery = n }
+}
+
+// WithCompactErrorHandler is called when the compaction that follows an ack
+// fails. The ack itself is durable by then, so Ack still succeeds and the
+// compaction is retried after the next ack. By default the error is dropped.
+func WithCompactErrorHandler(fn func(error)) Option {
+	return func(q *Queue) { q.onCompactError = fn }
+}
+
+type message struct {
+	payload    []byte
+	deliveries int
+	deadline   time.Time // zero while waiting to be handed out
+}
+
+// Queue is safe for concurrent use.
+type Queue struct {
+	path           string
+	visibility     time.Duration
+	compactEvery   int
+	onCompactError func(error)
+
+	mu       sync.Mutex
+	log      *logFile
+	nextID   uint64
+	messages map[uint64]*message // every message not yet acked
+	ready    []uint64            // waiting to be handed out, oldest first
+	acks     int                 // acks since the last compaction
+	changed  chan struct{}       // closed and replaced when ready grows
+}
+
+// Open opens the queue logged at path, creating it if needed.
+func Open(path string, opts ...Option) (*Queue, error) {
+	q := &Queue{
+		path:         path,
+		visibility:   30 * time.Second,
+		compactEvery: 1000,
+		messages:     make(map[uint64]*message),
+		changed:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	log, err := openLog(path, func(r record) error {
+		switch r.kind {
+		case kindEnqueue:
+			q.messages[r.id] = &message{payload: r.payload}
+		case kindAck:
+			delete(q.messages, r.id)
+		case kindNextID:
+			q.nextID = max(q.nextID, r.id)
+			return nil
+		default:
+			return fmt.Errorf("unknown record kind %d", r.kind)
+		}
+		q.nextID = max(q.nextID, r.id+1)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	q.log = log
+	for id := range q.messages {
+		q.ready = append(q.ready, id)
+	}
+	sort.Slice(q.ready, func(i, j int) bool { return q.ready[i] < q.ready[j] })
+	return q, nil
+}
+
+// Enqueue logs payload and queues it. The message is durable once Enqueue
+// returns. Payloads are limited to 64 MiB.
+func (q *Queue) Enqueue(payload []byte) (uint64, error) {
+	if len(payload) > maxPayload {
+		return 0, fmt.Errorf("%w: %d bytes", ErrTooLarge, len(payload))
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.log == nil {
+		return 0, ErrClosed
+	}
+	id := q.nextID
+	if err := q.log.append(record{kind: kindEnqueue, id: id, payload: payload}); err != nil {
+		return 0, err
+	}
+	q.nextID++
+	q.messages[id] = &message{payload: append([]byte(nil), payload...)}
+	q.ready = append(q.ready, id)
+	q.notify()
+	return id, nil
+}
+
+// Dequeue hands out the oldest message that is waiting, blocking until there
+// is one or ctx is done. The message must be acked within the visibility
+// timeout or it is handed out again.
+func (q *Queue) Dequeue(ctx context.Context) (Message, error) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for ctx.Err() == nil {
+		q.mu.Lock()
+		if q.log == nil {
+			q.mu.Unlock()
+			return Message{}, ErrClosed
+		}
+		now := time.Now()
+		q.requeueExpired(now)
+		if len(q.ready) > 0 {
+			id := q.ready[0]
+			q.ready = q.ready[1:]
+			m := q.messages[id]
+			m.deliveries++
+			m.deadline = now.Add(q.visibility)
+			msg := Message{ID: id, Payload: m.payload, Deliveries: m.deliveries}
+			q.mu.Unlock()
+			return msg, nil
+		}
+		wait := q.nextDeadline(now)
+		changed := q.changed
+		q.mu.Unlock()
+
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-timer.C:
+		}
+	}
+	return Message{}, ctx.Err()
+}
+
+// Ack logs that message id has been processed so that it is never delivered
+// again.
+func (q *Queue) Ack(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.log == nil {
+		return ErrClosed
+	}
+	m, ok := q.messages[id]
+	if !ok {
+		return ErrUnknownID
+	}
+	if m.deadline.IsZero() {
+		return ErrNotPending
+	}
+	if err := q.log.append(record{kind: kindAck, id: id}); err != nil {
+		return err
+	}
+	delete(q.messages, id)
+	q.acks++
+	if q.compactEvery > 0 && q.acks >= q.compactEvery {
+		if err := q.compact(); err != nil && q.onCompactError != nil {
+			q.onCompactError(err)
+		}
+	}
+	return nil
+}
+
+// Len returns how many messages have not been acked, handed out or not.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages)
+}
+
+// Compact rewrites the log to hold only the messages not yet acked, headed by
+// the next message id so ids are never reused after a restart.
+func (q *Queue) Compact() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.log == nil {
+		return ErrClosed
+	}
+	return q.compact()
+}
+
+func (q *Queue) compact() error {
+	ids := make([]uint64, 0, len(q.messages))
+	for id := range q.messages {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	records := []record{{kind: kindNextID, id: q.nextID}}
+	for _, id := range ids {
+		records = append(records, record{kind: kindEnqueue, id: id, payload: q.messages[id].payload})
+	}
+	log, err := rewriteLog(q.path, q.log, records)
+	if err != nil {
+		return err
+	}
+	q.log = log
+	q.acks = 0
+	return nil
+}
+
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.log == nil {
+		return nil
+	}
+	err := q.log.Close()
+	q.log = nil
+	q.notify()
+	return err
+}
+
+// requeueExpired puts handed out messages whose visibility timeout has passed
+// back in line, oldest first.
+func (q *Queue) requeueExpired(now time.Time) {
+	var expired []uint64
+	for id, m := range q.messages {
+		if !m.deadline.IsZero() && !m.deadline.After(now) {
+			m.deadline = time.Time{}
+			expired = append(expired, id)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	q.ready = append(q.ready, expired...)
+	sort.Slice(q.ready, func(i, j int) bool { return q.ready[i] < q.ready[j] })
+}
+
+// nextDeadline is how long until the next visibility timeout expires, or an
+// hour if nothing is handed out.
+func (q *Queue) nextDeadline(now time.Time) time.Duration {
+	wait := time.Hour
+	for _, m := range q.messages {
+		if !m.deadline.IsZero() {
+			wait = min(wait, m.deadline.Sub(now))
+		}
+	}
+	return wait
+}
+
+func (q *Queue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
@@ -0,0 +1,257 @@
+package durablequeue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestQueue(t *testing.T, path string, opts ...Option) *Queue {
+	q, err := Open(path, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func dequeue(t *testing.T, q *Queue) Message {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+	return m
+}
+
+func TestQueueDeliversInOrder(t *testing.T) {
+	q := openTestQueue(t, filepath.Join(t.TempDir(), "queue.wal"))
+	for _, p := range []string{"a", "b", "c"} {
+		_, err := q.Enqueue([]byte(p))
+		require.NoError(t, err)
+	}
+
+	for _, want := range []string{"a", "b", "c"} {
+		m := dequeue(t, q)
+		assert.Equal(t, want, string(m.Payload))
+		assert.Equal(t, 1, m.Deliveries)
+		require.NoError(t, q.Ack(m.ID))
+		assert.ErrorIs(t, q.Ack(m.ID), ErrUnknownID)
+	}
+	assert.Zero(t, q.Len())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := q.Dequeue(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestQueueRedeliversUnackedAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+	q, err := Open(path)
+	require.NoError(t, err)
+	for _, p := range []string{"a", "b", "c", "d"} {
+		_, err := q.Enqueue([]byte(p))
+		require.NoError(t, err)
+	}
+	a := dequeue(t, q)
+	require.NoError(t, q.Ack(a.ID))
+	b := dequeue(t, q) // handed out but never acked
+	require.NoError(t, q.Close())
+	_, err = q.Enqueue([]byte("e"))
+	assert.ErrorIs(t, err, ErrClosed)
+
+	q = openTestQueue(t, path)
+	assert.Equal(t, 3, q.Len())
+	got := dequeue(t, q)
+	assert.Equal(t, b.ID, got.ID)
+	assert.Equal(t, "b", string(got.Payload))
+	assert.Equal(t, "c", string(dequeue(t, q).Payload))
+
+	// New IDs carry on after the replayed ones.
+	id, err := q.Enqueue([]byte("e"))
+	require.NoError(t, err)
+	assert.Greater(t, id, got.ID+1)
+}
+
+func TestQueueRedeliversAfterVisibilityTimeout(t *testing.T) {
+	q := openTestQueue(t, filepath.Join(t.TempDir(), "queue.wal"), WithVisibilityTimeout(20*time.Millisecond))
+	q.Enqueue([]byte("a"))
+	first := dequeue(t, q)
+	assert.ErrorIs(t, q.Ack(first.ID+1), ErrUnknownID)
+
+	start := time.Now()
+	again := dequeue(t, q)
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+	assert.Equal(t, first.ID, again.ID)
+	assert.Equal(t, 2, again.Deliveries)
+	require.NoError(t, q.Ack(again.ID))
+}
+
+func TestQueueAckNeedsDelivery(t *testing.T) {
+	q := openTestQueue(t, filepath.Join(t.TempDir(), "queue.wal"))
+	id, err := q.Enqueue([]byte("a"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, q.Ack(id), ErrNotPending)
+
+	// A cancelled caller is not handed the waiting message.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = q.Dequeue(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, id, dequeue(t, q).ID)
+}
+
+func TestQueueCutsOffTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+	q, err := Open(path)
+	require.NoError(t, err)
+	q.Enqueue([]byte("kept"))
+	q.Enqueue([]byte("torn"))
+	require.NoError(t, q.Close())
+
+	// Chop the last record in half, as a crash during the write would.
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	q = openTestQueue(t, path)
+	assert.Equal(t, 1, q.Len())
+	assert.Equal(t, "kept", string(dequeue(t, q).Payload))
+	_, err = q.Enqueue([]byte("after"))
+	require.NoError(t, err)
+	require.NoError(t, q.Close())
+
+	q = openTestQueue(t, path)
+	assert.Equal(t, 2, q.Len())
+}
+
+func TestQueueRejectsCorruptionBeforeTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+	q, err := Open(path)
+	require.NoError(t, err)
+	q.Enqueue([]byte("first"))
+	q.Enqueue([]byte("second"))
+	require.NoError(t, q.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[headerSize] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = Open(path)
+	assert.ErrorIs(t, err, ErrCorrupt)
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, data, after, "a corrupt log must not be truncated")
+}
+
+func TestQueueRejectsDamagedLengthBeforeTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+	q, err := Open(path)
+	require.NoError(t, err)
+	for _, p := range []string{"a", "b", "c", "d", "e"} {
+		_, err := q.Enqueue([]byte(p))
+		require.NoError(t, err)
+	}
+	require.NoError(t, q.Close())
+
+	// The first record now claims to run past the end, like a torn tail.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[13] = 0x01
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = Open(path)
+	assert.ErrorIs(t, err, ErrCorrupt)
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, data, after)
+}
+
+func TestQueueRejectsOversizedPayload(t *testing.T) {
+	q := openTestQueue(t, filepath.Join(t.TempDir(), "queue.wal"))
+	_, err := q.Enqueue(make([]byte, maxPayload+1))
+	assert.ErrorIs(t, err, ErrTooLarge)
+	assert.Zero(t, q.Len())
+}
+
+func TestQueueCompactsAckedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+	q := openTestQueue(t, path, WithCompactEvery(5))
+	for i := 0; i < 10; i++ {
+		_, err := q.Enqueue([]byte{byte(i)})
+		require.NoError(t, err)
+	}
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, q.Ack(dequeue(t, q).ID))
+	}
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, before.Size()/2+headerSize, after.Size(), "only the next id and the five live enqueues are left")
+
+	// The compacted log keeps working and replays to the same state.
+	require.NoError(t, q.Ack(dequeue(t, q).ID))
+	require.NoError(t, q.Close())
+	q = openTestQueue(t, path)
+	assert.Equal(t, 4, q.Len())
+	assert.Equal(t, []byte{6}, dequeue(t, q).Payload)
+	require.NoError(t, q.Compact())
+	_, err = os.Stat(path + ".compact")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestQueueKeepsIDsUniqueAcrossCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+	q, err := Open(path)
+	require.NoError(t, err)
+	var last uint64
+	for i := 0; i < 3; i++ {
+		last, err = q.Enqueue([]byte{byte(i)})
+		require.NoError(t, err)
+		require.NoError(t, q.Ack(dequeue(t, q).ID))
+	}
+	require.NoError(t, q.Compact())
+	require.NoError(t, q.Close())
+
+	q = openTestQueue(t, path)
+	id, err := q.Enqueue([]byte("next"))
+	require.NoError(t, err)
+	assert.Greater(t, id, last)
+}
+
+func TestQueueAckSucceedsWhenCompactionFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "queue.wal")
+	var compactErrs []error
+	q := openTestQueue(t, path, WithCompactEvery(1), WithCompactErrorHandler(func(err error) {
+		compactErrs = append(compactErrs, err)
+	}))
+	_, err := q.Enqueue([]byte("a"))
+	require.NoError(t, err)
+	m := dequeue(t, q)
+
+	// A directory in the way of the temporary log makes the rewrite fail.
+	require.NoError(t, os.Mkdir(path+".compact", 0o755))
+	require.NoError(t, q.Ack(m.ID))
+	assert.Len(t, compactErrs, 1)
+	assert.Zero(t, q.Len())
+	assert.ErrorIs(t, q.Ack(m.ID), ErrUnknownID)
+}
+
+func TestQueueCloseReleasesDequeue(t *testing.T) {
+	q := openTestQueue(t, filepath.Join(t.TempDir(), "queue.wal"))
+	errs := make(chan error, 1)
+	go func() {
+		_, err := q.Dequeue(context.Background())
+		errs <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, q.Close())
+	assert.ErrorIs(t, <-errs, ErrClosed)
+}
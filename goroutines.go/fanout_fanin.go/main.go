@@ -1,44 +1,42 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"sync"
+	"time"
+
+	"revisitgo/goroutines.go/pipeline"
 )
 
 func main() {
 	nums := []int{2, 34, 5, 1, 1234, 34523, 5212}
 
-	var wg sync.WaitGroup
-	chIn := make(chan int, len(nums))
-	chOut := make(chan int, len(nums))
-	done := make(chan struct{})
-
-	for i := 0; i < 3; i++ {
-		wg.Add(1)
-		go processor(chIn, chOut, &wg)
-	}
+	// At most 10 values a second, with room for only 2 waiting values, so the
+	// sender below is held back instead of buffering the whole input.
+	stage := pipeline.New(processor,
+		pipeline.WithWorkers(2),
+		pipeline.WithBuffer(2),
+		pipeline.WithRateLimit(10, 2))
 
 	go func() {
-		for output := range chOut {
-			fmt.Println(output)
+		defer stage.Close()
+		for i, num := range nums {
+			if i == len(nums)/2 {
+				stage.Resize(3)
+			}
+			stage.Send(context.Background(), num)
 		}
-		done <- struct{}{}
 	}()
 
-	for _, num := range nums {
-		chIn <- num
+	for output := range stage.Out() {
+		m := stage.Metrics()
+		fmt.Printf("%d\t(queue %d/%d, %d workers)\n", output, m.QueueDepth, m.QueueCap, m.Workers)
 	}
-
-	close(chIn)
-	wg.Wait()
-	close(chOut)
-	<-done
+	m := stage.Metrics()
+	fmt.Printf("processed %d, average latency %v, max %v\n",
+		m.Processed, m.AvgLatency.Round(time.Millisecond), m.MaxLatency.Round(time.Millisecond))
 }
 
-func processor(chIn, chOut chan int, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	for ele := range chIn {
-		chOut <- ele * 2
-	}
+func processor(ele int) int {
+	return ele * 2
 }
@@ -1,35 +1,42 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sync"
+
+	"revisitgo/goroutines.go/sequencer"
+)
 
 func main() {
-	max := 1000
-	evenTurn := make(chan struct{})
-	oddTurn := make(chan struct{})
-	done := make(chan struct{})
+	max := flag.Int("max", 1000, "print the numbers below max")
+	printers := flag.Int("printers", 2, "goroutines taking turns; with 2 one prints the even numbers and the other the odd ones")
+	flag.Parse()
 
-	// Even printer
-	go func() {
-		for i := 0; i < max; i += 2 {
-			<-evenTurn
-			fmt.Println(i)
-			oddTurn <- struct{}{}
+	// Turn i prints i, so the numbers come out in order.
+	seq := sequencer.NewSchedule(*printers, func(turn int) int {
+		if turn >= *max {
+			return -1
 		}
-	}()
+		return turn % *printers
+	})
 
-	// Odd printer
-	go func() {
-		for i := 1; i < max; i += 2 {
-			<-oddTurn
-			fmt.Println(i)
-			if i+1 < max {
-				evenTurn <- struct{}{}
+	var wg sync.WaitGroup
+	for id := 0; id < *printers; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer seq.Leave(id)
+			for {
+				turn, err := seq.Wait(context.Background(), id)
+				if err != nil {
+					return
+				}
+				fmt.Println(turn)
+				seq.Done(id)
 			}
-		}
-		done <- struct{}{}
-	}()
-
-	// Start with even
-	evenTurn <- struct{}{}
-	<-done // wait for odd to finish
+		}()
+	}
+	wg.Wait()
 }
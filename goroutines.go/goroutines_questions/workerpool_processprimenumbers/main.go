@@ -1,55 +1,73 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+
+	"revisitgo/goroutines.go/primes"
+	"revisitgo/goroutines.go/workerpool"
+)
+
+type batch struct {
+	start, end int
+}
+
+var (
+	panicAt = flag.Int("panicat", -1, "make the batch holding this number panic, to show the pool recovering")
+	sieve   = flag.Bool("sieve", false, "use the segmented sieve instead of trial division in batches")
 )
 
 func main() {
+	flag.Parse()
 	n := 1000
+	if *sieve {
+		for prime := range primes.Range(0, uint64(n)) {
+			fmt.Println("prime number", prime)
+		}
+		fmt.Println("All numbers have been printed")
+		return
+	}
 	batchSize := 30
 	maxGoroutines := 4
 
-	chIn := make(chan int)
-	done := make(chan struct{}, maxGoroutines)
-	donePrinting := make(chan struct{})
+	// Results come back in batch order, so the primes print sorted.
+	pool := workerpool.New(processBatch,
+		workerpool.WithWorkers(maxGoroutines),
+		workerpool.WithOrderedResults())
 
-	// Printer goroutine
 	go func() {
-		for prime := range chIn {
-			fmt.Println("prime number", prime)
+		defer pool.Close()
+		for start := 0; start < n; start += batchSize {
+			pool.Submit(batch{start: start, end: min(start+batchSize, n)})
 		}
-		donePrinting <- struct{}{}
 	}()
 
-	batches := (n + batchSize - 1) / batchSize
-
-	for i := 0; i < batches; i++ {
-		// Block if maxGoroutines are in use
-		done <- struct{}{}
-
-		start := i * batchSize
-		end := min(start+batchSize, n)
-
-		go processBatch(start, end, chIn, done)
-	}
-
-	// Fill done buffer to ensure all goroutines complete
-	for i := 0; i < min(maxGoroutines, batches); i++ {
-		done <- struct{}{}
+	for res := range pool.Results() {
+		if res.Err != nil {
+			fmt.Println("batch", res.Index, "failed:", res.Err)
+			continue
+		}
+		for _, prime := range res.Value {
+			fmt.Println("prime number", prime)
+		}
 	}
-
-	close(chIn)
-	<-donePrinting
 	fmt.Println("All numbers have been printed")
+	if m := pool.Metrics(); m.Panics > 0 {
+		fmt.Println("batches that panicked:", m.Panics)
+	}
 }
 
-func processBatch(start, end int, ch chan int, done chan struct{}) {
-	defer func() { <-done }()
-	for i := start; i < end; i++ {
+func processBatch(b batch) ([]int, error) {
+	var primes []int
+	for i := b.start; i < b.end; i++ {
+		if i == *panicAt {
+			panic(fmt.Sprintf("cannot check %d", i))
+		}
 		if checkPrime(i) {
-			ch <- i
+			primes = append(primes, i)
 		}
 	}
+	return primes, nil
 }
 
 func checkPrime(num int) bool {
@@ -63,10 +81,3 @@ func checkPrime(num int) bool {
 	}
 	return true
 }
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
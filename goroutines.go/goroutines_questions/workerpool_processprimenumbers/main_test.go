@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"revisitgo/goroutines.go/primes"
+	"revisitgo/goroutines.go/workerpool"
+)
+
+// The benchmarks count the primes below a limit with trial division in
+// batches on a pool, as main does, and with the segmented sieve.
+
+func countWithPool(n int) int {
+	pool := workerpool.New(processBatch, workerpool.WithWorkers(4))
+	go func() {
+		defer pool.Close()
+		for start := 0; start < n; start += 30 {
+			pool.Submit(batch{start: start, end: min(start+30, n)})
+		}
+	}()
+	count := 0
+	for res := range pool.Results() {
+		count += len(res.Value)
+	}
+	return count
+}
+
+func TestPoolAndSieveAgree(t *testing.T) {
+	assert.Equal(t, primes.Count(0, 100_000), countWithPool(100_000))
+}
+
+func BenchmarkCheckPrime1e6(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		countWithPool(1_000_000)
+	}
+}
+
+func BenchmarkSieve1e6(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		primes.Count(0, 1_000_000, primes.WithWorkers(4))
+	}
+}
+
+func BenchmarkCheckPrimeSerial1e6(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		count := 0
+		for n := 0; n < 1_000_000; n++ {
+			if checkPrime(n) {
+				count++
+			}
+		}
+	}
+}
@@ -1,36 +1,84 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
 	"time"
 )
 
 // Worker pool pattern without using waitgroups
 
 func main() {
+	// Stop after five seconds, or earlier on Ctrl-C.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
 	inputCh := make(chan int)
+	maxVal := 1000
 	maxGoroutines := 10
 	done := make(chan struct{}, maxGoroutines)
 
-	go producer(inputCh, 1000)
+	go producer(ctx, inputCh, maxVal)
 
+	// Jobs never started and jobs interrupted mid-run are both abandoned.
+	var completed atomic.Int64
 	for data := range inputCh {
+		if ctx.Err() != nil {
+			continue
+		}
+		select {
+		case done <- struct{}{}:
+			// Both cases may have been ready; do not start after the deadline.
+			if ctx.Err() != nil {
+				<-done
+				continue
+			}
+			go consumer(ctx, data, done, &completed)
+		case <-ctx.Done():
+		}
+	}
+
+	// Taking every slot waits for the consumers still running.
+	for i := 0; i < maxGoroutines; i++ {
 		done <- struct{}{}
-		go consumer(data, done)
+	}
+
+	fmt.Printf("Completed %d jobs\n", completed.Load())
+	if abandoned := int64(maxVal) - completed.Load(); abandoned > 0 {
+		fmt.Printf("Abandoned %d jobs: %v\n", abandoned, context.Cause(ctx))
 	}
 }
 
-func consumer(num int, done chan struct{}) {
-	fmt.Println("Consuming num", num)
-	time.Sleep(4 * time.Second)
-	fmt.Println("Consumption completed for num ", num)
+// consumer works on num until it is done or ctx is, and counts it as
+// completed only in the first case.
+func consumer(ctx context.Context, num int, done chan struct{}, completed *atomic.Int64) {
 	defer func() {
 		<-done
 	}()
+	fmt.Println("Consuming num", num)
+	select {
+	case <-time.After(4 * time.Second):
+		completed.Add(1)
+		fmt.Println("Consumption completed for num ", num)
+	case <-ctx.Done():
+		fmt.Println("Consumption interrupted for num ", num)
+	}
 }
 
-func producer(inputCh chan int, maxVal int) {
+// producer sends 0 to maxVal-1 on inputCh and closes it, stopping early once
+// ctx is done.
+func producer(ctx context.Context, inputCh chan int, maxVal int) {
+	defer close(inputCh)
 	for i := 0; i < maxVal; i++ {
-		inputCh <- i
+		select {
+		case inputCh <- i:
+		case <-ctx.Done():
+			return
+		}
 	}
 }
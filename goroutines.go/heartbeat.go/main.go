@@ -1,32 +1,58 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"time"
+
+	"revisitgo/goroutines.go/supervisor"
 )
 
 func main() {
-	heartbeat := make(chan bool)
-	timer := time.NewTimer(6 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
 
-	go sendHeartbeat(heartbeat)
+	s := supervisor.New(
+		supervisor.WithWindow(1500*time.Millisecond),
+		supervisor.WithBackoff(500*time.Millisecond, 4*time.Second),
+	)
+	s.Add("steady", sendHeartbeat(0))
+	s.Add("flaky", sendHeartbeat(2))
 
-	for {
-		select {
-		case <-heartbeat:
-			fmt.Println("received heartbeat")
-		case <-timer.C:
-			fmt.Println("time is up, stopping the code")
-			close(heartbeat)
-			return
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, h := range s.Health() {
+					fmt.Printf("%-6s %-8s restarts=%d err=%v\n", h.Name, h.Status, h.Restarts, h.Err)
+				}
+			}
 		}
-	}
+	}()
+
+	s.Run(ctx)
+	fmt.Println("time is up, stopping the code")
 }
 
-// sendHeartbeat sends a heartbeat signal every second
-func sendHeartbeat(heartbeat chan bool) {
-	for {
-		time.Sleep(1 * time.Second)
-		heartbeat <- true
+// sendHeartbeat returns a worker that sends a heartbeat every second. With
+// hangAfter above zero it stops beating after that many, as if stuck.
+func sendHeartbeat(hangAfter int) supervisor.Worker {
+	return func(ctx context.Context, beat func()) error {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for beats := 0; hangAfter == 0 || beats < hangAfter; beats++ {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				beat()
+			}
+		}
+		<-ctx.Done()
+		return nil
 	}
 }
@@ -0,0 +1,214 @@
+// Package pipeline provides stages that process values on a pool of workers
+// which can be resized at runtime. A stage holds a bounded queue, so senders
+// block while it is full, and can be rate limited with a token bucket.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrClosed = errors.New("pipeline: stage is closed")
+
+type config struct {
+	workers int
+	buffer  int
+	limiter *Limiter
+}
+
+type Option func(*config)
+
+// WithWorkers sets how many workers the stage starts with. The default is 1.
+func WithWorkers(n int) Option {
+	return func(c *config) { c.workers = n }
+}
+
+// WithBuffer sets how many values may wait in the queue and in the output
+// before the stage applies backpressure. The default is 1.
+func WithBuffer(n int) Option {
+	return func(c *config) { c.buffer = n }
+}
+
+// WithRateLimit caps the stage at rate values per second across all of its
+// workers, allowing bursts of up to burst values. rate must be positive.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(c *config) { c.limiter = NewLimiter(rate, burst) }
+}
+
+// Metrics is a snapshot of a stage. Latency is measured from Send to the
+// result being ready, so it includes time spent in the queue.
+type Metrics struct {
+	Workers    int
+	QueueDepth int
+	QueueCap   int
+	Processed  int
+	AvgLatency time.Duration
+	MaxLatency time.Duration
+}
+
+type item[In any] struct {
+	value In
+	sent  time.Time
+}
+
+// Stage applies fn to every value sent to it and delivers the results on
+// Out in completion order.
+type Stage[In, Out any] struct {
+	fn      func(In) Out
+	queue   chan item[In]
+	out     chan Out
+	limiter *Limiter
+
+	sendMu sync.RWMutex // held for writing only to close queue
+	closed bool
+
+	mu        sync.Mutex
+	stops     []chan struct{} // one per worker not yet told to stop
+	running   int             // workers still running, stopped or not
+	drained   bool
+	outClosed bool
+	processed int
+	total     time.Duration
+	slowest   time.Duration
+}
+
+// New starts a stage applying fn.
+func New[In, Out any](fn func(In) Out, opts ...Option) *Stage[In, Out] {
+	cfg := config{workers: 1, buffer: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.buffer = max(cfg.buffer, 1)
+
+	s := &Stage[In, Out]{
+		fn:      fn,
+		queue:   make(chan item[In], cfg.buffer),
+		out:     make(chan Out, cfg.buffer),
+		limiter: cfg.limiter,
+	}
+	s.Resize(cfg.workers)
+	return s
+}
+
+// Send queues v, blocking while the queue is full. It fails with ctx's error
+// if ctx is done first, and with ErrClosed after Close.
+func (s *Stage[In, Out]) Send(ctx context.Context, v In) error {
+	s.sendMu.RLock()
+	defer s.sendMu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	select {
+	case s.queue <- item[In]{value: v, sent: time.Now()}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting values. Queued values are still processed, and Out
+// is closed after the last result.
+func (s *Stage[In, Out]) Close() {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+}
+
+func (s *Stage[In, Out]) Out() <-chan Out {
+	return s.out
+}
+
+// Resize grows or shrinks the pool to n workers, at least 1. A worker that is
+// told to stop finishes the value it is working on first.
+func (s *Stage[In, Out]) Resize(n int) {
+	n = max(n, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.stops) < n {
+		stop := make(chan struct{})
+		s.stops = append(s.stops, stop)
+		s.running++
+		go s.work(stop)
+	}
+	for len(s.stops) > n {
+		last := len(s.stops) - 1
+		close(s.stops[last])
+		s.stops = s.stops[:last]
+	}
+}
+
+func (s *Stage[In, Out]) Metrics() Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := Metrics{
+		Workers:    len(s.stops),
+		QueueDepth: len(s.queue),
+		QueueCap:   cap(s.queue),
+		Processed:  s.processed,
+		MaxLatency: s.slowest,
+	}
+	if s.processed > 0 {
+		m.AvgLatency = s.total / time.Duration(s.processed)
+	}
+	return m
+}
+
+func (s *Stage[In, Out]) work(stop chan struct{}) {
+	for {
+		// Stop before taking another value, even if the queue is not empty.
+		select {
+		case <-stop:
+			s.exit(stop, false)
+			return
+		default:
+		}
+		select {
+		case <-stop:
+			s.exit(stop, false)
+			return
+		case it, ok := <-s.queue:
+			if !ok {
+				s.exit(stop, true)
+				return
+			}
+			if s.limiter != nil {
+				s.limiter.Wait(context.Background())
+			}
+			result := s.fn(it.value)
+			s.record(time.Since(it.sent))
+			s.out <- result
+		}
+	}
+}
+
+// exit removes a worker from the pool. Once the queue has been drained the
+// last worker to leave closes Out.
+func (s *Stage[In, Out]) exit(stop chan struct{}, drained bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.drained = s.drained || drained
+	for i, c := range s.stops {
+		if c == stop {
+			s.stops = append(s.stops[:i], s.stops[i+1:]...)
+			break
+		}
+	}
+	if s.drained && s.running == 0 && !s.outClosed {
+		s.outClosed = true
+		close(s.out)
+	}
+}
+
+func (s *Stage[In, Out]) record(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processed++
+	s.total += latency
+	s.slowest = max(s.slowest, latency)
+}
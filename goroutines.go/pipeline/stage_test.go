@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collect[T any](ch <-chan T) []T {
+	var out []T
+	for v := range ch {
+		out = append(out, v)
+	}
+	return out
+}
+
+func TestStageProcessesEveryValue(t *testing.T) {
+	s := New(func(n int) int { return n * 2 }, WithWorkers(3), WithBuffer(2))
+	go func() {
+		defer s.Close()
+		for i := 0; i < 50; i++ {
+			require.NoError(t, s.Send(context.Background(), i))
+		}
+	}()
+
+	got := collect(s.Out())
+	sort.Ints(got)
+	require.Len(t, got, 50)
+	assert.Equal(t, 98, got[49])
+	m := s.Metrics()
+	assert.Equal(t, 50, m.Processed)
+	assert.Zero(t, m.QueueDepth)
+	assert.Equal(t, 2, m.QueueCap)
+	assert.Positive(t, m.MaxLatency)
+	assert.LessOrEqual(t, m.AvgLatency, m.MaxLatency)
+
+	assert.ErrorIs(t, s.Send(context.Background(), 1), ErrClosed)
+}
+
+func TestStageAppliesBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	s := New(func(n int) int {
+		<-release
+		return n
+	}, WithBuffer(1))
+
+	// One value is being processed and one waits in the queue, so the third
+	// send cannot get in.
+	ctx := context.Background()
+	require.NoError(t, s.Send(ctx, 1))
+	require.Eventually(t, func() bool { return s.Metrics().QueueDepth == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, s.Send(ctx, 2))
+	assert.Equal(t, 1, s.Metrics().QueueDepth)
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Send(short, 3), context.DeadlineExceeded)
+
+	close(release)
+	s.Close()
+	assert.ElementsMatch(t, []int{1, 2}, collect(s.Out()))
+}
+
+func TestStageResizesAtRuntime(t *testing.T) {
+	var running, peak atomic.Int32
+	s := New(func(n int) int {
+		cur := running.Add(1)
+		for old := peak.Load(); cur > old && !peak.CompareAndSwap(old, cur); old = peak.Load() {
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return n
+	}, WithWorkers(1), WithBuffer(10))
+	s.Resize(0)
+	assert.Equal(t, 1, s.Metrics().Workers)
+
+	s.Resize(4)
+	assert.Equal(t, 4, s.Metrics().Workers)
+	go func() {
+		defer s.Close()
+		for i := 0; i < 40; i++ {
+			s.Send(context.Background(), i)
+			if i == 20 {
+				s.Resize(2)
+				assert.Equal(t, 2, s.Metrics().Workers)
+			}
+		}
+	}()
+	assert.Len(t, collect(s.Out()), 40)
+	assert.LessOrEqual(t, peak.Load(), int32(4))
+	assert.Zero(t, s.Metrics().Workers)
+}
+
+func TestStageRateLimit(t *testing.T) {
+	s := New(func(n int) int { return n }, WithWorkers(4), WithBuffer(10), WithRateLimit(200, 2))
+	start := time.Now()
+	go func() {
+		defer s.Close()
+		for i := 0; i < 10; i++ {
+			s.Send(context.Background(), i)
+		}
+	}()
+	assert.Len(t, collect(s.Out()), 10)
+
+	// A burst of 2, then 8 more at 5ms each.
+	assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+}
+
+func TestLimiterWaitHonoursContext(t *testing.T) {
+	l := NewLimiter(1, 1)
+	require.NoError(t, l.Wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestLimiterNeedsPositiveRate(t *testing.T) {
+	assert.Panics(t, func() { NewLimiter(0, 1) })
+	assert.Panics(t, func() { NewLimiter(-5, 1) })
+	assert.Panics(t, func() { New(func(n int) int { return n }, WithRateLimit(0, 1)) })
+}
@@ -0,0 +1,197 @@
+// Package primes finds primes with a segmented Sieve of Eratosthenes. A
+// range is cut into fixed size segments that workers sieve concurrently;
+// results are delivered in order while only a bounded number of segments is
+// in memory, so ranges far beyond what fits in a single sieve work.
+package primes
+
+import (
+	"context"
+	"iter"
+	"math"
+	"runtime"
+)
+
+type config struct {
+	workers     int
+	segmentSize uint64
+}
+
+type Option func(*config)
+
+// WithWorkers sets how many segments are sieved at once. The default is one
+// per CPU.
+func WithWorkers(n int) Option {
+	return func(c *config) { c.workers = n }
+}
+
+// WithSegmentSize sets how many numbers each segment covers. The default of
+// 1<<16 keeps a segment's sieve in the CPU cache.
+func WithSegmentSize(n uint64) Option {
+	return func(c *config) { c.segmentSize = n }
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{workers: runtime.NumCPU(), segmentSize: 1 << 16}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.workers = max(cfg.workers, 1)
+	cfg.segmentSize = max(cfg.segmentSize, 1)
+	return cfg
+}
+
+// Range yields the primes in [lo, hi) in increasing order. Stopping the
+// iteration early stops the workers.
+func Range(lo, hi uint64, opts ...Option) iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		for primes := range segments(lo, hi, newConfig(opts), appendPrimes) {
+			for _, p := range primes {
+				if !yield(p) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Count returns how many primes there are in [lo, hi).
+func Count(lo, hi uint64, opts ...Option) int {
+	n := 0
+	for c := range segments(lo, hi, newConfig(opts), countPrimes) {
+		n += c
+	}
+	return n
+}
+
+// Nth returns the nth prime, counting 2 as the first. It returns 0 for n < 1.
+func Nth(n int, opts ...Option) uint64 {
+	if n < 1 {
+		return 0
+	}
+	i := 0
+	for p := range Range(0, nthUpperBound(n), opts...) {
+		if i++; i == n {
+			return p
+		}
+	}
+	panic("primes: upper bound for the nth prime is too low")
+}
+
+// nthUpperBound is Rosser's bound: the nth prime is below n(ln n + ln ln n)
+// for n >= 6.
+func nthUpperBound(n int) uint64 {
+	if n < 6 {
+		return 13
+	}
+	f := float64(n)
+	return uint64(f*(math.Log(f)+math.Log(math.Log(f)))) + 1
+}
+
+// segments sieves [lo, hi) in segments and yields fn's result for each, in
+// order. At most 2*workers segments are sieved or waiting at any time.
+func segments[T any](lo, hi uint64, cfg config, fn func(composite []bool, lo uint64) T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		if lo >= hi {
+			return
+		}
+		base := basePrimes(isqrt(hi - 1))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// Each segment gets its own result channel; queueing those channels
+		// in order lets the workers finish in any order.
+		pending := make(chan chan T, cfg.workers)
+		sem := make(chan struct{}, cfg.workers)
+		go func() {
+			defer close(pending)
+			for start := lo; start < hi; {
+				end := hi
+				if hi-start > cfg.segmentSize {
+					end = start + cfg.segmentSize
+				}
+				result := make(chan T, 1)
+				select {
+				case pending <- result:
+				case <-ctx.Done():
+					return
+				}
+				sem <- struct{}{}
+				go func(start, end uint64) {
+					defer func() { <-sem }()
+					result <- fn(sieveSegment(base, start, end), start)
+				}(start, end)
+				start = end
+			}
+		}()
+
+		for result := range pending {
+			if !yield(<-result) {
+				return
+			}
+		}
+	}
+}
+
+// sieveSegment marks the composites in [lo, hi) given every prime up to
+// sqrt(hi-1). Index i stands for lo+i; 0 and 1 count as composite.
+func sieveSegment(base []uint64, lo, hi uint64) []bool {
+	composite := make([]bool, hi-lo)
+	for n := lo; n < min(hi, 2); n++ {
+		composite[n-lo] = true
+	}
+	for _, p := range base {
+		start := max(p*p, (lo+p-1)/p*p)
+		for m := start; m < hi; m += p {
+			composite[m-lo] = true
+		}
+	}
+	return composite
+}
+
+func appendPrimes(composite []bool, lo uint64) []uint64 {
+	var primes []uint64
+	for i, c := range composite {
+		if !c {
+			primes = append(primes, lo+uint64(i))
+		}
+	}
+	return primes
+}
+
+func countPrimes(composite []bool, _ uint64) int {
+	n := 0
+	for _, c := range composite {
+		if !c {
+			n++
+		}
+	}
+	return n
+}
+
+// basePrimes returns the primes up to and including limit with a plain sieve.
+func basePrimes(limit uint64) []uint64 {
+	if limit < 2 {
+		return nil
+	}
+	composite := make([]bool, limit+1)
+	composite[0], composite[1] = true, true
+	for p := uint64(2); p*p <= limit; p++ {
+		if !composite[p] {
+			for m := p * p; m <= limit; m += p {
+				composite[m] = true
+			}
+		}
+	}
+	return appendPrimes(composite, 0)
+}
+
+func isqrt(n uint64) uint64 {
+	r := uint64(math.Sqrt(float64(n)))
+	for r*r > n {
+		r--
+	}
+	for (r+1)*(r+1) <= n {
+		r++
+	}
+	return r
+}
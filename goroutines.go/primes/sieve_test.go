@@ -0,0 +1,87 @@
+package primes
+
+import (
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func trialDivision(n uint64) bool {
+	if n < 2 {
+		return false
+	}
+	for d := uint64(2); d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRangeMatchesTrialDivision(t *testing.T) {
+	for _, r := range [][2]uint64{{0, 1000}, {1, 2}, {2, 3}, {997, 1010}, {100_000, 101_000}, {50, 50}, {60, 40}} {
+		var want []uint64
+		for n := r[0]; n < r[1]; n++ {
+			if trialDivision(n) {
+				want = append(want, n)
+			}
+		}
+		// Tiny segments make sure primes are stitched together in order.
+		got := slices.Collect(Range(r[0], r[1], WithSegmentSize(7), WithWorkers(3)))
+		assert.Equal(t, want, got, "range %v", r)
+	}
+}
+
+func TestCount(t *testing.T) {
+	assert.Equal(t, 25, Count(0, 100))
+	assert.Equal(t, 78_498, Count(0, 1_000_000))
+	assert.Equal(t, 0, Count(24, 29))
+	assert.Equal(t, Count(0, 1_000_000), Count(0, 1_000_000, WithWorkers(1), WithSegmentSize(1000)))
+}
+
+func TestNth(t *testing.T) {
+	assert.Zero(t, Nth(0))
+	assert.Equal(t, uint64(2), Nth(1))
+	assert.Equal(t, uint64(11), Nth(5))
+	assert.Equal(t, uint64(13), Nth(6))
+	assert.Equal(t, uint64(7919), Nth(1000))
+	assert.Equal(t, uint64(104_729), Nth(10_000))
+}
+
+func TestRangeNearTenToTheTen(t *testing.T) {
+	// 10^10 - 33 and 10^10 + 19 are the primes around 10^10.
+	got := slices.Collect(Range(9_999_999_960, 10_000_000_020))
+	assert.Equal(t, []uint64{9_999_999_967, 10_000_000_019}, got)
+}
+
+func TestRangeStopsEarly(t *testing.T) {
+	before := runtime.NumGoroutine()
+	var got []uint64
+	for p := range Range(0, 10_000_000_000, WithSegmentSize(100)) {
+		if got = append(got, p); len(got) == 5 {
+			break
+		}
+	}
+	assert.Equal(t, []uint64{2, 3, 5, 7, 11}, got)
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func BenchmarkCount(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Count(0, 10_000_000)
+	}
+}
+
+func BenchmarkCountHighRange(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Count(9_990_000_000, 10_000_000_000)
+	}
+}
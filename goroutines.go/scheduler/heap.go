@@ -0,0 +1,51 @@
+package scheduler
+
+// entryHeap is a container/heap of jobs ordered by less.
+type entryHeap struct {
+	entries []*entry
+	less    func(a, b *entry) bool
+}
+
+// byPriority orders due jobs by priority, highest first, then by when they
+// were queued.
+func byPriority(a, b *entry) bool {
+	if a.job.Priority != b.job.Priority {
+		return a.job.Priority > b.job.Priority
+	}
+	return a.seq < b.seq
+}
+
+// byDueTime orders waiting jobs by when they become due, then by when they
+// were queued.
+func byDueTime(a, b *entry) bool {
+	if !a.due.Equal(b.due) {
+		return a.due.Before(b.due)
+	}
+	return a.seq < b.seq
+}
+
+func (h *entryHeap) Len() int           { return len(h.entries) }
+func (h *entryHeap) Less(i, j int) bool { return h.less(h.entries[i], h.entries[j]) }
+func (h *entryHeap) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *entryHeap) Push(x any)         { h.entries = append(h.entries, x.(*entry)) }
+
+func (h *entryHeap) Pop() any {
+	last := len(h.entries) - 1
+	e := h.entries[last]
+	h.entries[last] = nil
+	h.entries = h.entries[:last]
+	return e
+}
+
+func (h *entryHeap) peek() *entry {
+	return h.entries[0]
+}
+
+func (h *entryHeap) find(id int) int {
+	for i, e := range h.entries {
+		if e.id == id {
+			return i
+		}
+	}
+	return -1
+}
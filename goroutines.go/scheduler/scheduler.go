@@ -0,0 +1,214 @@
+// Package scheduler runs jobs on a pool of workers in priority order. Jobs
+// may be held back until a not-before time, and may recur on a schedule.
+// Whenever a worker is free it gets the highest priority job that is due.
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrUnknownJob = errors.New("scheduler: unknown job")
+
+// Schedule decides when a recurring job runs next.
+type Schedule interface {
+	// Next returns the first run time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+type every time.Duration
+
+// Every runs a job on every multiple of d since the Unix epoch, the way a
+// cron entry such as "*/5 * * * *" runs on every fifth minute. Like
+// time.NewTicker, it panics if d is not positive.
+func Every(d time.Duration) Schedule {
+	if d <= 0 {
+		panic("scheduler: non-positive interval for Every")
+	}
+	return every(d)
+}
+
+func (e every) Next(t time.Time) time.Time {
+	d := time.Duration(e)
+	return t.Truncate(d).Add(d)
+}
+
+// Job is a unit of work. Among the jobs that are due, higher priorities run
+// first, and jobs of equal priority run in the order they were queued.
+type Job struct {
+	Name      string
+	Priority  int
+	NotBefore time.Time // zero to run as soon as possible
+	Repeat    Schedule  // nil to run once
+	Run       func(ctx context.Context) error
+}
+
+type Option func(*Scheduler)
+
+// WithWorkers sets how many jobs run at once. The default is 1.
+func WithWorkers(n int) Option {
+	return func(s *Scheduler) { s.workers = max(n, 1) }
+}
+
+// WithErrorHandler is called with every job that returns an error. By
+// default errors are dropped.
+func WithErrorHandler(fn func(job Job, err error)) Option {
+	return func(s *Scheduler) { s.onError = fn }
+}
+
+type entry struct {
+	id  int
+	job Job
+	due time.Time
+	seq int // order of queueing, to keep equal priorities FIFO
+}
+
+// Scheduler holds jobs until they are due and hands them to its workers.
+type Scheduler struct {
+	workers int
+	onError func(Job, error)
+
+	mu        sync.Mutex
+	nextID    int
+	seq       int
+	ready     entryHeap
+	delayed   entryHeap
+	changed   chan struct{} // closed and replaced whenever a job is added
+	running   map[int]bool
+	cancelled map[int]bool // recurring jobs cancelled while running
+}
+
+func New(opts ...Option) *Scheduler {
+	s := &Scheduler{
+		workers:   1,
+		ready:     entryHeap{less: byPriority},
+		delayed:   entryHeap{less: byDueTime},
+		changed:   make(chan struct{}),
+		running:   make(map[int]bool),
+		cancelled: make(map[int]bool),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Add schedules job and returns an ID for Cancel. A recurring job with no
+// NotBefore first runs at its schedule's next time.
+func (s *Scheduler) Add(job Job) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	e := &entry{id: s.nextID, job: job, due: job.NotBefore}
+	if e.due.IsZero() && job.Repeat != nil {
+		e.due = job.Repeat.Next(time.Now())
+	}
+	s.push(e)
+	return e.id
+}
+
+// Cancel removes a job that has not run yet, or stops a recurring job from
+// running again. A run already in progress is not interrupted.
+func (s *Scheduler) Cancel(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.ready.find(id); i >= 0 {
+		heap.Remove(&s.ready, i)
+		return nil
+	}
+	if i := s.delayed.find(id); i >= 0 {
+		heap.Remove(&s.delayed, i)
+		return nil
+	}
+	if s.running[id] {
+		s.cancelled[id] = true
+		return nil
+	}
+	return ErrUnknownJob
+}
+
+// Len returns how many jobs are waiting, due or not.
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ready.Len() + s.delayed.Len()
+}
+
+// push queues e and wakes the idle workers. s.mu must be held.
+func (s *Scheduler) push(e *entry) {
+	s.seq++
+	e.seq = s.seq
+	heap.Push(&s.delayed, e)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Run starts the workers and returns once ctx is cancelled and the jobs they
+// are running have finished. Jobs still waiting stay queued.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) work(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for ctx.Err() == nil {
+		e, wait, changed := s.take()
+		if e != nil {
+			s.run(ctx, e)
+			continue
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-timer.C:
+		}
+	}
+}
+
+// take pops the highest priority due job. If none is due it returns how long
+// until the next one is, and a channel that is closed when a job is added.
+func (s *Scheduler) take() (*entry, time.Duration, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for s.delayed.Len() > 0 && !s.delayed.peek().due.After(now) {
+		heap.Push(&s.ready, heap.Pop(&s.delayed))
+	}
+	if s.ready.Len() > 0 {
+		e := heap.Pop(&s.ready).(*entry)
+		s.running[e.id] = true
+		return e, 0, nil
+	}
+	wait := time.Hour
+	if s.delayed.Len() > 0 {
+		wait = s.delayed.peek().due.Sub(now)
+	}
+	return nil, wait, s.changed
+}
+
+func (s *Scheduler) run(ctx context.Context, e *entry) {
+	if err := e.job.Run(ctx); err != nil && s.onError != nil {
+		s.onError(e.job, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, e.id)
+	if e.job.Repeat != nil && !s.cancelled[e.id] {
+		e.due = e.job.Repeat.Next(time.Now())
+		s.push(e)
+	}
+	delete(s.cancelled, e.id)
+}
@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder collects the names of the jobs that ran, in order.
+type recorder struct {
+	mu    sync.Mutex
+	names []string
+	times []time.Time
+}
+
+func (r *recorder) job(name string, priority int) Job {
+	return Job{Name: name, Priority: priority, Run: func(context.Context) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.names = append(r.names, name)
+		r.times = append(r.times, time.Now())
+		return nil
+	}}
+}
+
+func (r *recorder) ran() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.names...)
+}
+
+func start(s *Scheduler) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestHighestPriorityRunsFirst(t *testing.T) {
+	var r recorder
+	s := New()
+	s.Add(r.job("low", 1))
+	s.Add(r.job("high", 10))
+	s.Add(r.job("mid", 5))
+	s.Add(r.job("mid-later", 5))
+
+	stop := start(s)
+	require.Eventually(t, func() bool { return len(r.ran()) == 4 }, time.Second, time.Millisecond)
+	stop()
+	assert.Equal(t, []string{"high", "mid", "mid-later", "low"}, r.ran())
+	assert.Zero(t, s.Len())
+}
+
+func TestNotBeforeHoldsJobsBack(t *testing.T) {
+	var r recorder
+	s := New()
+	added := time.Now()
+	late := r.job("late", 100)
+	late.NotBefore = added.Add(30 * time.Millisecond)
+	s.Add(late)
+	s.Add(r.job("now", 0))
+
+	stop := start(s)
+	defer stop()
+	require.Eventually(t, func() bool { return len(r.ran()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"now", "late"}, r.ran())
+	assert.False(t, r.times[1].Before(late.NotBefore))
+}
+
+func TestRecurringJobs(t *testing.T) {
+	var r recorder
+	s := New(WithWorkers(2))
+	id := s.Add(Job{Name: "tick", Repeat: Every(10 * time.Millisecond), Run: r.job("tick", 0).Run})
+
+	stop := start(s)
+	defer stop()
+	require.Eventually(t, func() bool { return len(r.ran()) >= 3 }, time.Second, time.Millisecond)
+	require.NoError(t, s.Cancel(id))
+	n := len(r.ran())
+	time.Sleep(40 * time.Millisecond)
+	assert.LessOrEqual(t, len(r.ran()), n+1, "at most a run already in progress finishes")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := 1; i < len(r.times); i++ {
+		assert.GreaterOrEqual(t, r.times[i].Sub(r.times[i-1]), 5*time.Millisecond)
+	}
+}
+
+func TestEveryAlignsToMultiples(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 7, 30, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 10, 0, 0, time.UTC), Every(5*time.Minute).Next(at))
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC), Every(5*time.Minute).Next(at.Add(150*time.Second)))
+	assert.Panics(t, func() { Every(0) })
+	assert.Panics(t, func() { Every(-time.Second) })
+}
+
+func TestCancelAndErrors(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		failed []string
+	)
+	errBoom := errors.New("boom")
+	s := New(WithErrorHandler(func(job Job, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.ErrorIs(t, err, errBoom)
+		failed = append(failed, job.Name)
+	}))
+	var r recorder
+	id := s.Add(r.job("cancelled", 0))
+	s.Add(Job{Name: "failing", Run: func(context.Context) error { return errBoom }})
+	require.NoError(t, s.Cancel(id))
+	assert.ErrorIs(t, s.Cancel(id), ErrUnknownJob)
+
+	stop := start(s)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(failed) == 1
+	}, time.Second, time.Millisecond)
+	stop()
+	assert.Equal(t, []string{"failing"}, failed)
+	assert.Empty(t, r.ran())
+}
+
+func TestWorkersShareTheQueue(t *testing.T) {
+	s := New(WithWorkers(3))
+	release := make(chan struct{})
+	var mu sync.Mutex
+	running := 0
+	for i := 0; i < 3; i++ {
+		s.Add(Job{Run: func(context.Context) error {
+			mu.Lock()
+			running++
+			mu.Unlock()
+			<-release
+			return nil
+		}})
+	}
+	stop := start(s)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return running == 3
+	}, time.Second, time.Millisecond)
+	close(release)
+	stop()
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
+
+	"revisitgo/goroutines.go/channels"
 )
 
 func sendData(ch chan int, data []int) {
@@ -14,28 +17,15 @@ func sendData(ch chan int, data []int) {
 func main() {
 	ch1 := make(chan int)
 	ch2 := make(chan int)
+	ch3 := make(chan int)
 
 	go sendData(ch1, []int{1, 2, 3})
 	go sendData(ch2, []int{4, 5, 6})
+	go sendData(ch3, []int{7, 8, 9, 10})
 
-	for {
-		select {
-		case msg1, ok := <-ch1:
-			if !ok {
-				ch1 = nil
-			} else {
-				fmt.Println("Received from ch1:", msg1)
-			}
-		case msg2, ok := <-ch2:
-			if !ok {
-				ch2 = nil
-			} else {
-				fmt.Println("Received from ch2:", msg2)
-			}
-		}
-
-		if ch1 == nil && ch2 == nil {
-			break
-		}
+	ctx := context.Background()
+	merged := channels.Merge(ctx, ch1, ch2, ch3)
+	for batch := range channels.Batch(ctx, merged, 4, 0) {
+		fmt.Println("Received batch:", batch)
 	}
 }
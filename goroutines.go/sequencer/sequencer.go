@@ -0,0 +1,165 @@
+// Package sequencer lets a fixed set of goroutines take turns: at any time
+// exactly one of them holds the turn, and the schedule decides who is next.
+package sequencer
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrClosed is returned once the schedule has ended, every participant
+	// has left, or Close was called.
+	ErrClosed  = errors.New("sequencer: closed")
+	ErrLeft    = errors.New("sequencer: participant has left")
+	ErrNotTurn = errors.New("sequencer: participant does not hold the turn")
+
+	ErrUnknownParticipant = errors.New("sequencer: no such participant")
+)
+
+// maxSkippedTurns is how many turns in a row may fall to participants that
+// have left before the schedule is taken to name no one else, and ends.
+const maxSkippedTurns = 1 << 16
+
+// Sequencer hands the turn from participant to participant. Participants are
+// numbered from 0 to n-1.
+type Sequencer struct {
+	next func(turn int) int
+
+	mu      sync.Mutex
+	turn    int
+	holder  int  // participant owning turn, -1 once closed
+	held    bool // whether holder has returned from Wait for turn
+	left    []bool
+	active  int
+	changed chan struct{} // closed and replaced whenever holder changes
+}
+
+// New returns a sequencer passing the turn round-robin between n
+// participants, starting with participant 0. n must be at least 1.
+func New(n int) *Sequencer {
+	return NewSchedule(n, func(turn int) int { return turn % n })
+}
+
+// NewSchedule returns a sequencer that gives turn t to participant next(t).
+// next returns -1, or any number outside [0, n), to end the sequence. Turns
+// that fall to a participant that has left are skipped; after maxSkippedTurns
+// skipped turns in a row the sequence ends, so a schedule that keeps naming
+// only those who left cannot stall the others forever.
+func NewSchedule(n int, next func(turn int) int) *Sequencer {
+	if n < 1 {
+		panic("sequencer: need at least one participant")
+	}
+	s := &Sequencer{
+		next:    next,
+		turn:    -1,
+		left:    make([]bool, n),
+		active:  n,
+		changed: make(chan struct{}),
+	}
+	s.advance()
+	return s
+}
+
+// advance moves the turn to the next participant that has not left, ending
+// the sequence after maxSkippedTurns skipped turns in a row. s.mu must be
+// held.
+func (s *Sequencer) advance() {
+	for skipped := 0; ; skipped++ {
+		s.turn++
+		s.holder = s.next(s.turn)
+		if s.holder < 0 || s.holder >= len(s.left) || s.active == 0 {
+			s.holder = -1
+			break
+		}
+		if !s.left[s.holder] {
+			break
+		}
+		if skipped == maxSkippedTurns {
+			s.holder = -1
+			break
+		}
+	}
+	s.held = false
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Wait blocks until it is participant id's turn and returns the turn number,
+// counting from 0. The participant holds the turn until it calls Done or
+// Leave.
+func (s *Sequencer) Wait(ctx context.Context, id int) (int, error) {
+	if id < 0 || id >= len(s.left) {
+		return 0, ErrUnknownParticipant
+	}
+	for {
+		s.mu.Lock()
+		switch {
+		case s.left[id]:
+			s.mu.Unlock()
+			return 0, ErrLeft
+		case s.holder < 0:
+			s.mu.Unlock()
+			return 0, ErrClosed
+		case s.holder == id:
+			s.held = true
+			turn := s.turn
+			s.mu.Unlock()
+			return turn, nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// Done ends id's turn and passes it on.
+func (s *Sequencer) Done(id int) error {
+	if id < 0 || id >= len(s.left) {
+		return ErrUnknownParticipant
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder != id || !s.held {
+		return ErrNotTurn
+	}
+	s.advance()
+	return nil
+}
+
+// Leave removes id from the sequence, passing the turn on if id holds it or
+// is due to. A participant that stops early must leave, or the others wait
+// for it forever.
+func (s *Sequencer) Leave(id int) error {
+	if id < 0 || id >= len(s.left) {
+		return ErrUnknownParticipant
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.left[id] {
+		return nil
+	}
+	s.left[id] = true
+	s.active--
+	if s.holder >= 0 && (s.holder == id || s.active == 0) {
+		s.advance()
+	}
+	return nil
+}
+
+// Close ends the sequence: every Wait, pending or future, returns ErrClosed.
+func (s *Sequencer) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder >= 0 {
+		s.holder = -1
+		close(s.changed)
+		s.changed = make(chan struct{})
+	}
+}
@@ -0,0 +1,194 @@
+package sequencer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run starts n participants that take turns until Wait fails or stop says
+// so, and returns who held each turn, in order.
+func run(t *testing.T, s *Sequencer, n int, stop func(id, turn int) bool) []int {
+	var mu sync.Mutex
+	var order []int
+	last := -1
+	var wg sync.WaitGroup
+	for id := 0; id < n; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				turn, err := s.Wait(context.Background(), id)
+				if err != nil {
+					assert.ErrorIs(t, err, ErrClosed)
+					return
+				}
+				if stop(id, turn) {
+					s.Leave(id)
+					return
+				}
+				mu.Lock()
+				assert.Greater(t, turn, last, "turns are handed out in order")
+				last = turn
+				order = append(order, id)
+				mu.Unlock()
+				require.NoError(t, s.Done(id))
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("participants deadlocked")
+	}
+	return order
+}
+
+func TestRoundRobin(t *testing.T) {
+	s := New(3)
+	order := run(t, s, 3, func(_, turn int) bool {
+		if turn == 9 {
+			s.Close()
+			return true
+		}
+		return false
+	})
+	assert.Equal(t, []int{0, 1, 2, 0, 1, 2, 0, 1, 2}, order)
+}
+
+func TestCustomSchedule(t *testing.T) {
+	schedule := []int{2, 0, 0, 1, 2, 2}
+	s := NewSchedule(3, func(turn int) int {
+		if turn >= len(schedule) {
+			return -1
+		}
+		return schedule[turn]
+	})
+	order := run(t, s, 3, func(int, int) bool { return false })
+	assert.Equal(t, schedule, order)
+}
+
+func TestParticipantLeavingEarly(t *testing.T) {
+	s := NewSchedule(3, func(turn int) int {
+		if turn >= 12 {
+			return -1
+		}
+		return turn % 3
+	})
+	// Participant 1 leaves on its second turn; its later turns are skipped.
+	order := run(t, s, 3, func(id, turn int) bool { return id == 1 && turn == 4 })
+	assert.Equal(t, []int{0, 1, 2, 0, 2, 0, 2, 0, 2}, order)
+}
+
+func TestEveryoneLeaving(t *testing.T) {
+	s := New(2)
+	order := run(t, s, 2, func(_, turn int) bool { return turn >= 2 })
+	assert.Equal(t, []int{0, 1}, order)
+	_, err := s.Wait(context.Background(), 0)
+	assert.ErrorIs(t, err, ErrLeft)
+}
+
+func TestLeavingBeforeFirstTurn(t *testing.T) {
+	s := New(2)
+	s.Leave(0)
+	s.Leave(0)
+	turn, err := s.Wait(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, turn)
+}
+
+func TestScheduleNamingOnlyLeftParticipantsEnds(t *testing.T) {
+	s := NewSchedule(2, func(turn int) int {
+		if turn == 0 {
+			return 0
+		}
+		return 1
+	})
+	s.Leave(1)
+	_, err := s.Wait(context.Background(), 0)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Done(0) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Done never returned")
+	}
+	_, err = s.Wait(context.Background(), 0)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestSkippingLeftParticipantKeepsLaterTurns(t *testing.T) {
+	schedule := []int{0, 0, 0, 1, 1}
+	s := NewSchedule(2, func(turn int) int {
+		if turn < len(schedule) {
+			return schedule[turn]
+		}
+		return -1
+	})
+	_, err := s.Wait(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Leave(0))
+
+	for _, want := range []int{3, 4} {
+		turn, err := s.Wait(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, want, turn)
+		require.NoError(t, s.Done(1))
+	}
+	_, err = s.Wait(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestUnknownParticipant(t *testing.T) {
+	s := New(2)
+	_, err := s.Wait(context.Background(), 5)
+	assert.ErrorIs(t, err, ErrUnknownParticipant)
+	assert.ErrorIs(t, s.Done(-1), ErrUnknownParticipant)
+	assert.ErrorIs(t, s.Leave(2), ErrUnknownParticipant)
+}
+
+func TestNeedsAParticipant(t *testing.T) {
+	assert.Panics(t, func() { New(0) })
+}
+
+func TestWaitHonoursContext(t *testing.T) {
+	s := New(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := s.Wait(ctx, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.ErrorIs(t, s.Done(1), ErrNotTurn)
+	assert.ErrorIs(t, s.Done(0), ErrNotTurn, "the turn is not held before Wait")
+}
+
+func TestCloseReleasesWaiters(t *testing.T) {
+	s := New(4)
+	errs := make(chan error, 3)
+	for id := 1; id < 4; id++ {
+		go func() {
+			_, err := s.Wait(context.Background(), id)
+			errs <- err
+		}()
+	}
+	s.Close()
+	for i := 0; i < 3; i++ {
+		assert.True(t, errors.Is(<-errs, ErrClosed))
+	}
+	_, err := s.Wait(context.Background(), 0)
+	assert.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,228 @@
+// Package supervisor keeps long running workers alive. Every worker sends
+// heartbeats while it makes progress; one that misses its heartbeat window or
+// returns an error is cancelled and restarted after an exponential backoff.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrStalled = errors.New("supervisor: worker missed its heartbeat window")
+
+// Status is where a worker is in its life cycle.
+type Status int
+
+const (
+	Starting Status = iota // started, no heartbeat yet
+	Healthy                // beat within the window
+	Stalled                // missed the window, waiting to restart
+	Failed                 // returned an error, waiting to restart
+	Stopped                // finished, or the supervisor shut down
+)
+
+func (s Status) String() string {
+	switch s {
+	case Starting:
+		return "starting"
+	case Healthy:
+		return "healthy"
+	case Stalled:
+		return "stalled"
+	case Failed:
+		return "failed"
+	case Stopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// Worker runs until ctx is cancelled, calling beat at least once per
+// heartbeat window. Returning nil stops it for good; returning an error gets
+// it restarted.
+type Worker func(ctx context.Context, beat func()) error
+
+// Health is a snapshot of one worker.
+type Health struct {
+	Name     string
+	Status   Status
+	LastBeat time.Time // zero until the first heartbeat
+	Restarts int
+	Err      error // why the worker was last restarted
+}
+
+type Option func(*Supervisor)
+
+// WithWindow sets how long a worker may go without a heartbeat before it
+// counts as stalled. The default is one second.
+func WithWindow(d time.Duration) Option {
+	return func(s *Supervisor) { s.window = d }
+}
+
+// WithBackoff sets the delay before the first restart and the cap it doubles
+// up to while a worker keeps failing. The defaults are 100ms and 10s.
+func WithBackoff(min, max time.Duration) Option {
+	return func(s *Supervisor) { s.minBackoff, s.maxBackoff = min, max }
+}
+
+type worker struct {
+	fn     Worker
+	health Health
+}
+
+// Supervisor runs a fixed set of workers.
+type Supervisor struct {
+	window     time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu      sync.Mutex
+	workers []*worker
+	running bool
+}
+
+func New(opts ...Option) *Supervisor {
+	s := &Supervisor{
+		window:     time.Second,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Add registers a worker under a unique name. Workers must be added before
+// Run is called.
+func (s *Supervisor) Add(name string, fn Worker) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return errors.New("supervisor: cannot add a worker while running")
+	}
+	for _, w := range s.workers {
+		if w.health.Name == name {
+			return fmt.Errorf("supervisor: duplicate worker %q", name)
+		}
+	}
+	s.workers = append(s.workers, &worker{fn: fn, health: Health{Name: name}})
+	return nil
+}
+
+// Run starts every worker and keeps them running until ctx is cancelled.
+// It returns once the workers have returned, giving any that ignore the
+// cancellation one heartbeat window to do so.
+func (s *Supervisor) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.running = true
+	workers := s.workers
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.supervise(ctx, w)
+		}()
+	}
+	wg.Wait()
+}
+
+// Health returns a snapshot of every worker in the order they were added.
+func (s *Supervisor) Health() []Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	health := make([]Health, len(s.workers))
+	for i, w := range s.workers {
+		health[i] = w.health
+	}
+	return health
+}
+
+func (s *Supervisor) update(w *worker, fn func(h *Health)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&w.health)
+}
+
+func (s *Supervisor) supervise(ctx context.Context, w *worker) {
+	defer s.update(w, func(h *Health) { h.Status = Stopped })
+	failures := 0
+	for {
+		err := s.attempt(ctx, w, &failures)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		status := Failed
+		if errors.Is(err, ErrStalled) {
+			status = Stalled
+		}
+		s.update(w, func(h *Health) { h.Status, h.Err = status, err })
+
+		delay := s.backoff(failures)
+		failures++
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		s.update(w, func(h *Health) { h.Restarts++ })
+	}
+}
+
+// attempt runs w once and returns nil when it finished or the supervisor shut
+// down, ErrStalled when it missed the window, or the error it returned.
+// A heartbeat resets failures, so a recovered worker backs off from the
+// minimum again.
+func (s *Supervisor) attempt(ctx context.Context, w *worker, failures *int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The channel is never closed, so a stalled worker that wakes up after
+	// being replaced can still call beat safely.
+	beats := make(chan struct{}, 1)
+	beat := func() {
+		select {
+		case beats <- struct{}{}:
+		default:
+		}
+	}
+	exited := make(chan error, 1)
+	s.update(w, func(h *Health) { h.Status = Starting })
+	go func() { exited <- w.fn(ctx, beat) }()
+
+	timer := time.NewTimer(s.window)
+	defer timer.Stop()
+	for {
+		select {
+		case <-beats:
+			*failures = 0
+			now := time.Now()
+			s.update(w, func(h *Health) { h.Status, h.LastBeat = Healthy, now })
+			timer.Reset(s.window)
+		case err := <-exited:
+			return err
+		case <-timer.C:
+			return ErrStalled
+		case <-ctx.Done():
+			select {
+			case <-exited:
+			case <-time.After(s.window):
+			}
+			return nil
+		}
+	}
+}
+
+func (s *Supervisor) backoff(failures int) time.Duration {
+	d := s.minBackoff
+	for i := 0; i < failures && d < s.maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, s.maxBackoff)
+}
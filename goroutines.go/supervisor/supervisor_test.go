@@ -0,0 +1,132 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// beating beats every few milliseconds until ctx is cancelled.
+func beating(ctx context.Context, beat func()) error {
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			beat()
+		}
+	}
+}
+
+func start(t *testing.T, s *Supervisor) (cancel func()) {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	return func() {
+		cancelCtx()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Run did not return after cancel")
+		}
+	}
+}
+
+func health(s *Supervisor, name string) Health {
+	for _, h := range s.Health() {
+		if h.Name == name {
+			return h
+		}
+	}
+	return Health{}
+}
+
+func TestSupervisorRestartsStalledWorker(t *testing.T) {
+	s := New(WithWindow(30*time.Millisecond), WithBackoff(time.Millisecond, time.Millisecond))
+	var attempts atomic.Int32
+	require.NoError(t, s.Add("flaky", func(ctx context.Context, beat func()) error {
+		if attempts.Add(1) == 1 {
+			// Beat once, then hang without honouring ctx.
+			beat()
+			time.Sleep(100 * time.Millisecond)
+			beat()
+			return nil
+		}
+		return beating(ctx, beat)
+	}))
+	stop := start(t, s)
+
+	require.Eventually(t, func() bool {
+		h := health(s, "flaky")
+		return h.Restarts == 1 && h.Status == Healthy
+	}, time.Second, 5*time.Millisecond)
+	h := health(s, "flaky")
+	assert.ErrorIs(t, h.Err, ErrStalled)
+	assert.False(t, h.LastBeat.IsZero())
+
+	stop()
+	assert.Equal(t, Stopped, health(s, "flaky").Status)
+	assert.EqualValues(t, 2, attempts.Load())
+}
+
+func TestSupervisorBacksOffFailingWorker(t *testing.T) {
+	s := New(WithWindow(time.Second), WithBackoff(10*time.Millisecond, 40*time.Millisecond))
+	errBoom := errors.New("boom")
+	var attempts atomic.Int32
+	require.NoError(t, s.Add("failing", func(context.Context, func()) error {
+		attempts.Add(1)
+		return errBoom
+	}))
+	stop := start(t, s)
+
+	// Delays of 10, 20, 40 and 40ms put the fifth attempt at 110ms or later.
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	assert.LessOrEqual(t, attempts.Load(), int32(5))
+	assert.GreaterOrEqual(t, attempts.Load(), int32(2))
+	h := health(s, "failing")
+	assert.ErrorIs(t, h.Err, errBoom)
+	assert.Equal(t, Stopped, h.Status)
+	assert.Equal(t, int(attempts.Load())-1, h.Restarts)
+}
+
+func TestSupervisorLeavesFinishedWorkerStopped(t *testing.T) {
+	s := New(WithWindow(20 * time.Millisecond))
+	require.NoError(t, s.Add("once", func(_ context.Context, beat func()) error {
+		beat()
+		return nil
+	}))
+	require.NoError(t, s.Add("steady", beating))
+	assert.Error(t, s.Add("once", beating))
+	stop := start(t, s)
+
+	require.Eventually(t, func() bool {
+		return health(s, "once").Status == Stopped && health(s, "steady").Status == Healthy
+	}, time.Second, 5*time.Millisecond)
+	assert.Error(t, s.Add("late", beating))
+
+	// Well past the window the steady worker has never been restarted.
+	time.Sleep(60 * time.Millisecond)
+	assert.Zero(t, health(s, "steady").Restarts)
+	assert.Zero(t, health(s, "once").Restarts)
+
+	stop()
+	for _, h := range s.Health() {
+		assert.Equal(t, Stopped, h.Status, h.Name)
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	assert.Equal(t, "stalled", Stalled.String())
+	assert.Equal(t, "Status(9)", Status(9).String())
+}
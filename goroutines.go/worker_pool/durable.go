@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"revisitgo/goroutines.go/durablequeue"
+)
+
+type durableJob struct {
+	Number int `json:"number"`
+}
+
+// runDurable works through jobs kept in a write-ahead log at path. Interrupt
+// it with Ctrl-C and run it again: the jobs that were not acked are picked up
+// where it left off.
+func runDurable(path string) error {
+	q, err := durablequeue.Open(path, durablequeue.WithVisibilityTimeout(5*time.Second), durablequeue.WithCompactEvery(5))
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	if q.Len() == 0 {
+		for i := 0; i < 10; i++ {
+			payload, _ := json.Marshal(durableJob{Number: i * 3})
+			if _, err := q.Enqueue(payload); err != nil {
+				return err
+			}
+		}
+	} else {
+		fmt.Println("resuming", q.Len(), "unfinished jobs")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msg, err := q.Dequeue(ctx)
+				if err != nil {
+					return
+				}
+				var job durableJob
+				if err := json.Unmarshal(msg.Payload, &job); err != nil {
+					fmt.Println("dropping malformed job", msg.ID, err)
+					q.Ack(msg.ID)
+					continue
+				}
+				time.Sleep(time.Millisecond * 500)
+				fmt.Println("Result from job ", msg.ID, job.Number*2)
+				if err := q.Ack(msg.ID); err != nil {
+					fmt.Println("ack job", msg.ID, err)
+				}
+				if q.Len() == 0 {
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
@@ -1,55 +1,88 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"sync"
+	"math/rand/v2"
 	"time"
+
+	"revisitgo/goroutines.go/workerpool"
 )
 
-type Job struct {
-	ID     int
-	Number int
-}
+var errUnavailable = errors.New("service unavailable")
 
-type Result struct {
-	JobID  int
-	Output int
-}
-
-func worker(id int, result chan Result, jobs chan Job, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for job := range jobs {
-		fmt.Println("started worker ", id)
-		time.Sleep(time.Millisecond * 500)
-		result <- Result{JobID: job.ID, Output: job.Number * 2}
-		fmt.Println("stopped worker ", id)
+// double fails now and then like a call to a flaky service, always fails for
+// numbers it cannot handle, and has a bug that panics on 12.
+func double(n int) (int, error) {
+	time.Sleep(time.Millisecond * 500)
+	if n == 12 {
+		var cache map[int]int
+		cache[n] = n * 2
+	}
+	if n%7 == 6 {
+		return 0, workerpool.Permanent(fmt.Errorf("cannot double %d", n))
 	}
+	if rand.N(3) == 0 {
+		return 0, errUnavailable
+	}
+	return n * 2, nil
 }
 
 func main() {
-	jobs := make(chan Job, 10)
-	result := make(chan Result, 10)
-
-	var wg sync.WaitGroup
+	failFast := flag.Bool("failfast", false, "cancel the remaining jobs on the first failed job")
+	scheduled := flag.Bool("scheduled", false, "run prioritised, delayed and recurring jobs on a scheduler instead")
+	wal := flag.String("wal", "", "keep the jobs in a write-ahead log at this path so they survive restarts")
+	flag.Parse()
+	if *scheduled {
+		runScheduled()
+		return
+	}
+	if *wal != "" {
+		if err := runDurable(*wal); err != nil {
+			fmt.Println("durable queue:", err)
+		}
+		return
+	}
 
-	for i := 0; i < 3; i++ {
-		wg.Add(1)
-		go worker(i, result, jobs, &wg)
+	opts := []workerpool.Option{
+		workerpool.WithWorkers(3),
+		workerpool.WithQueueSize(10),
+		workerpool.WithRetry(workerpool.RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     100 * time.Millisecond,
+			MaxBackoff:  time.Second,
+		}),
+	}
+	if *failFast {
+		opts = append(opts, workerpool.WithCancelOnError())
 	}
+	pool := workerpool.New(double, opts...)
 
 	go func() {
+		defer pool.Close()
 		for i := 0; i < 10; i++ {
-			jobs <- Job{ID: i, Number: i * 3}
+			pool.Submit(i * 3)
 		}
-		close(jobs)
-	}()
-
-	go func() {
-		wg.Wait()
-		close(result)
 	}()
 
-	for res := range result {
-		fmt.Println("Result from job ", res)
+	for res := range pool.Results() {
+		if res.Err != nil {
+			fmt.Println("Job ", res.Index, "failed after", res.Attempts, "attempts:", res.Err)
+			continue
+		}
+		fmt.Println("Result from job ", res.Index, res.Value, "after", res.Attempts, "attempts")
+	}
+	if err := pool.Wait(); err != nil {
+		fmt.Println("Pool cancelled:", err)
+	}
+	for _, d := range pool.DeadLetters() {
+		fmt.Printf("Dead letter: job %d input %d: %v\n", d.Index, d.Input, d.Err)
+		var perr *workerpool.PanicError
+		if errors.As(d.Err, &perr) {
+			fmt.Printf("%s\n", perr.Stack)
+		}
 	}
+	m := pool.Metrics()
+	fmt.Printf("Completed %d, failed %d, panics %d, workers restarted %d\n", m.Completed, m.Failed, m.Panics, m.Restarts)
 }
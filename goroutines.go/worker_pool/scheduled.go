@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"revisitgo/goroutines.go/scheduler"
+)
+
+// runScheduled runs jobs by priority instead of in arrival order: urgent jobs
+// overtake queued ones, a delayed job waits for its time and a recurring job
+// reports every second until the demo ends.
+func runScheduled() {
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	s := scheduler.New(scheduler.WithWorkers(3))
+	start := time.Now()
+	job := func(name string, priority int) scheduler.Job {
+		return scheduler.Job{Name: name, Priority: priority, Run: func(context.Context) error {
+			fmt.Printf("%5v %s (priority %d)\n", time.Since(start).Round(100*time.Millisecond), name, priority)
+			time.Sleep(time.Millisecond * 500)
+			return nil
+		}}
+	}
+	for i := 0; i < 6; i++ {
+		s.Add(job(fmt.Sprintf("batch job %d", i), 0))
+	}
+	s.Add(job("urgent job", 10))
+	delayed := job("delayed job", 5)
+	delayed.NotBefore = start.Add(2 * time.Second)
+	s.Add(delayed)
+	report := job("report", 1)
+	report.Repeat = scheduler.Every(time.Second)
+	s.Add(report)
+
+	s.Run(ctx)
+	fmt.Println("jobs left unrun:", s.Len())
+}
@@ -0,0 +1,80 @@
+package workerpool
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolRecoversPanickingJobs(t *testing.T) {
+	results := Map([]int{1, 0, 2, 0, 3}, func(n int) (int, error) {
+		time.Sleep(time.Millisecond)
+		return 6 / n, nil
+	}, WithWorkers(2))
+
+	require.Len(t, results, 5)
+	assert.Equal(t, []int{6, 3, 2}, []int{results[0].Value, results[2].Value, results[4].Value})
+	for _, i := range []int{1, 3} {
+		var perr *PanicError
+		require.ErrorAs(t, results[i].Err, &perr)
+		assert.Contains(t, perr.Error(), "integer divide by zero")
+		assert.Contains(t, string(perr.Stack), "panic_test.go")
+
+		var rerr runtime.Error
+		assert.ErrorAs(t, results[i].Err, &rerr)
+	}
+}
+
+func TestPoolRestartsWorkerAfterPanic(t *testing.T) {
+	var attempts int
+	p := New(func(n int) (int, error) {
+		if n == 1 {
+			attempts++
+			if attempts < 3 {
+				panic("flaky")
+			}
+		}
+		return n, nil
+	}, WithWorkers(1), WithRetry(RetryPolicy{MaxAttempts: 3}))
+	go func() {
+		defer p.Close()
+		for i := 0; i < 3; i++ {
+			p.Submit(i)
+		}
+	}()
+
+	var got []int
+	for r := range p.Results() {
+		require.NoError(t, r.Err)
+		got = append(got, r.Value)
+	}
+	require.NoError(t, p.Wait())
+	assert.Equal(t, []int{0, 1, 2}, got)
+	assert.Equal(t, Metrics{Completed: 3, Panics: 2, Restarts: 1}, p.Metrics())
+	assert.Empty(t, p.DeadLetters())
+}
+
+func TestPoolCountsFailures(t *testing.T) {
+	p := New(func(n int) (int, error) {
+		if n%2 == 1 {
+			panic(n)
+		}
+		return n, nil
+	}, WithWorkers(3), WithQueueSize(10))
+	for i := 0; i < 10; i++ {
+		p.Submit(i)
+	}
+	p.Close()
+	for range p.Results() {
+	}
+	p.Wait()
+
+	assert.Equal(t, Metrics{Completed: 5, Failed: 5, Panics: 5, Restarts: 5}, p.Metrics())
+	dead := p.DeadLetters()
+	require.Len(t, dead, 5)
+	assert.EqualError(t, dead[0].Err, fmt.Sprintf("workerpool: job panicked: %d", dead[0].Input))
+}
@@ -0,0 +1,62 @@
+package workerpool
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy decides how often a failing job is run again. The zero value
+// runs every job once.
+type RetryPolicy struct {
+	MaxAttempts int           // including the first run; below 1 means 1
+	Backoff     time.Duration // delay before the second attempt
+	MaxBackoff  time.Duration // cap on the doubling delay; 0 means no cap
+}
+
+// delay is how long to wait after the given number of failed attempts: the
+// backoff doubled for every earlier retry, then jittered down by up to half
+// so that jobs failing together do not retry together.
+func (r RetryPolicy) delay(attempts int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < attempts && (r.MaxBackoff == 0 || d < r.MaxBackoff); i++ {
+		d *= 2
+	}
+	if r.MaxBackoff > 0 {
+		d = min(d, r.MaxBackoff)
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func (r RetryPolicy) retryable(err error, attempts int) bool {
+	var perm *permanentError
+	return attempts < r.MaxAttempts && !errors.As(err, &perm)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying: the job fails on the spot
+// whatever the retry policy.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// DeadLetter is a job that failed for good, kept with its input so it can be
+// inspected or resubmitted.
+type DeadLetter[In any] struct {
+	Index    int
+	Input    In
+	Attempts int
+	Err      error
+}
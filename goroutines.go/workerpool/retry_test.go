@@ -0,0 +1,141 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errFlaky = errors.New("flaky")
+
+func TestRetryPolicyDelay(t *testing.T) {
+	r := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+	for attempts, want := range map[int]time.Duration{1: 10, 2: 20, 3: 40, 4: 40, 10: 40} {
+		want *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			d := r.delay(attempts)
+			assert.GreaterOrEqual(t, d, want/2)
+			assert.LessOrEqual(t, d, want)
+		}
+	}
+	assert.Zero(t, RetryPolicy{}.delay(3))
+}
+
+func TestPoolRetriesFailingJobs(t *testing.T) {
+	var calls atomic.Int32
+	// Every input fails on its first two runs.
+	var mu sync.Mutex
+	seen := make(map[int]int)
+	results := Map([]int{1, 2, 3}, func(n int) (int, error) {
+		calls.Add(1)
+		mu.Lock()
+		seen[n]++
+		runs := seen[n]
+		mu.Unlock()
+		if runs <= 2 {
+			return 0, errFlaky
+		}
+		return n, nil
+	}, WithWorkers(3), WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+
+	for i, r := range results {
+		assert.NoError(t, r.Err)
+		assert.Equal(t, i+1, r.Value)
+		assert.Equal(t, 3, r.Attempts)
+	}
+	assert.EqualValues(t, 9, calls.Load())
+}
+
+func TestPoolCollectsDeadLetters(t *testing.T) {
+	errBad := errors.New("bad input")
+	p := New(func(n int) (int, error) {
+		switch {
+		case n < 0:
+			return 0, Permanent(errBad)
+		case n == 0:
+			return 0, errFlaky
+		}
+		return n, nil
+	}, WithWorkers(1), WithOrderedResults(), WithRetry(RetryPolicy{MaxAttempts: 4}))
+	go func() {
+		defer p.Close()
+		for _, n := range []int{5, 0, -1, 7} {
+			p.Submit(n)
+		}
+	}()
+
+	var results []Result[int]
+	for r := range p.Results() {
+		results = append(results, r)
+	}
+	require.NoError(t, p.Wait())
+	require.Len(t, results, 4)
+	assert.Equal(t, 1, results[0].Attempts)
+	assert.ErrorIs(t, results[1].Err, errFlaky)
+	assert.Equal(t, 4, results[1].Attempts)
+	assert.ErrorIs(t, results[2].Err, errBad)
+	assert.Equal(t, 1, results[2].Attempts)
+	assert.Equal(t, 7, results[3].Value)
+
+	dead := p.DeadLetters()
+	require.Len(t, dead, 2)
+	assert.Equal(t, DeadLetter[int]{Index: 1, Input: 0, Attempts: 4, Err: errFlaky}, dead[0])
+	assert.Equal(t, -1, dead[1].Input)
+	assert.ErrorIs(t, dead[1].Err, errBad)
+}
+
+func TestPoolCancelsOnFirstFatalError(t *testing.T) {
+	errFatal := errors.New("fatal")
+	var ran atomic.Int32
+	p := NewWithContext(context.Background(), func(ctx context.Context, n int) (int, error) {
+		ran.Add(1)
+		if n == 3 {
+			return 0, errFatal
+		}
+		if n > 3 {
+			// Would run forever unless the pool is cancelled.
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return n, nil
+	}, WithWorkers(2), WithQueueSize(20), WithCancelOnError())
+	for i := 0; i < 20; i++ {
+		_, err := p.Submit(i)
+		require.NoError(t, err)
+	}
+	p.Close()
+
+	var skipped int
+	for r := range p.Results() {
+		if errors.Is(r.Err, ErrSkipped) {
+			skipped++
+			assert.Zero(t, r.Attempts)
+		}
+	}
+	assert.ErrorIs(t, p.Wait(), errFatal)
+	assert.Positive(t, skipped)
+	assert.EqualValues(t, 20-skipped, ran.Load())
+}
+
+func TestPoolStopsWithParentContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewWithContext(ctx, func(ctx context.Context, n int) (int, error) {
+		return n, nil
+	}, WithWorkers(1), WithQueueSize(5))
+	cancel()
+	for i := 0; i < 5; i++ {
+		p.Submit(i)
+	}
+	p.Close()
+	for r := range p.Results() {
+		assert.ErrorIs(t, r.Err, ErrSkipped)
+	}
+	assert.ErrorIs(t, p.Wait(), context.Canceled)
+	assert.Empty(t, p.DeadLetters())
+}
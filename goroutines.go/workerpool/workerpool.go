@@ -0,0 +1,320 @@
+// Package workerpool runs a function over submitted inputs on a fixed number
+// of goroutines and streams the results back, optionally in submission order.
+// Failing jobs can be retried with backoff; jobs that fail for good are kept
+// as dead letters.
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrClosed = errors.New("workerpool: pool is closed")
+	// ErrSkipped is the error of jobs that were not run because the pool had
+	// been cancelled.
+	ErrSkipped = errors.New("workerpool: job skipped, pool cancelled")
+)
+
+// Result is the outcome of one job. Index is the position of its input in
+// submission order, starting at 0.
+type Result[Out any] struct {
+	Index    int
+	Value    Out
+	Err      error
+	Attempts int
+}
+
+type config struct {
+	workers       int
+	queueSize     int
+	ordered       bool
+	retry         RetryPolicy
+	cancelOnError bool
+}
+
+type Option func(*config)
+
+// WithWorkers sets how many jobs run at once. The default is one per CPU.
+func WithWorkers(n int) Option {
+	return func(c *config) { c.workers = n }
+}
+
+// WithQueueSize sets how many submitted jobs may wait for a worker before
+// Submit blocks. The default is the number of workers.
+func WithQueueSize(n int) Option {
+	return func(c *config) { c.queueSize = n }
+}
+
+// WithOrderedResults delivers results in submission order instead of
+// completion order. Results that finish early are held back until every
+// earlier one has been delivered.
+func WithOrderedResults() Option {
+	return func(c *config) { c.ordered = true }
+}
+
+// WithRetry runs failing jobs again as the policy allows.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *config) { c.retry = policy }
+}
+
+// WithCancelOnError cancels the pool when a job fails for good, like an
+// errgroup: the context passed to running jobs is cancelled, jobs that have
+// not started fail with ErrSkipped and Wait returns the job's error.
+func WithCancelOnError() Option {
+	return func(c *config) { c.cancelOnError = true }
+}
+
+// Metrics counts what a pool has done so far.
+type Metrics struct {
+	Completed int64 // jobs that succeeded
+	Failed    int64 // jobs that failed for good, including skipped ones
+	Panics    int64 // job runs that panicked, retries included
+	Restarts  int64 // workers replaced after a panic
+}
+
+type job[In any] struct {
+	index int
+	in    In
+}
+
+// Pool feeds submitted inputs to fn on its workers. Results must be read
+// from Results while jobs are running, or the workers block once it is full.
+type Pool[In, Out any] struct {
+	fn      func(context.Context, In) (Out, error)
+	cfg     config
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	jobs    chan job[In]
+	results chan Result[Out]
+	done    chan struct{} // closed once results is closed
+	err     error         // why ctx was cancelled, set before done is closed
+
+	mu     sync.Mutex // guards next and closed, and orders sends on jobs
+	next   int
+	closed bool
+
+	deadMu sync.Mutex
+	dead   []DeadLetter[In]
+
+	completed, failed, panics, restarts atomic.Int64
+}
+
+// New starts the workers of a pool that applies fn to every submitted input.
+func New[In, Out any](fn func(In) (Out, error), opts ...Option) *Pool[In, Out] {
+	return NewWithContext(context.Background(), func(_ context.Context, in In) (Out, error) {
+		return fn(in)
+	}, opts...)
+}
+
+// NewWithContext is New for jobs that take a context. The context is
+// cancelled when ctx is, or by WithCancelOnError; either way the jobs still
+// queued are skipped.
+func NewWithContext[In, Out any](ctx context.Context, fn func(context.Context, In) (Out, error), opts ...Option) *Pool[In, Out] {
+	cfg := config{workers: runtime.NumCPU()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.workers = max(cfg.workers, 1)
+	if cfg.queueSize <= 0 {
+		cfg.queueSize = cfg.workers
+	}
+
+	cfg.retry.MaxAttempts = max(cfg.retry.MaxAttempts, 1)
+
+	p := &Pool[In, Out]{
+		fn:      fn,
+		cfg:     cfg,
+		jobs:    make(chan job[In], cfg.queueSize),
+		results: make(chan Result[Out], cfg.workers),
+		done:    make(chan struct{}),
+	}
+	p.ctx, p.cancel = context.WithCancelCause(ctx)
+	out := p.results
+	if cfg.ordered {
+		out = make(chan Result[Out], cfg.workers)
+		go p.reorder(out)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.workers; i++ {
+		wg.Add(1)
+		go p.work(&wg, out)
+	}
+	go func() {
+		wg.Wait()
+		if p.ctx.Err() != nil {
+			p.err = context.Cause(p.ctx)
+		}
+		p.cancel(nil)
+		close(out)
+		if !cfg.ordered {
+			close(p.done)
+		}
+	}()
+	return p
+}
+
+func (p *Pool[In, Out]) work(wg *sync.WaitGroup, out chan<- Result[Out]) {
+	defer wg.Done()
+	for j := range p.jobs {
+		r, panicked := p.run(j)
+		out <- r
+		if panicked {
+			// The panic may have left state owned by this goroutine broken,
+			// so a fresh one takes over the rest of the queue.
+			p.restarts.Add(1)
+			wg.Add(1)
+			go p.work(wg, out)
+			return
+		}
+	}
+}
+
+// run tries j as often as the retry policy allows and files it as a dead
+// letter if it never succeeds. It reports whether any attempt panicked.
+func (p *Pool[In, Out]) run(j job[In]) (r Result[Out], panicked bool) {
+	r.Index = j.index
+	if p.ctx.Err() != nil {
+		r.Err = ErrSkipped
+		p.failed.Add(1)
+		return r, false
+	}
+	for {
+		r.Attempts++
+		r.Value, r.Err = call(p.ctx, p.fn, j.in)
+		var perr *PanicError
+		if errors.As(r.Err, &perr) {
+			p.panics.Add(1)
+			panicked = true
+		}
+		if r.Err == nil || !p.cfg.retry.retryable(r.Err, r.Attempts) || !p.sleep(p.cfg.retry.delay(r.Attempts)) {
+			break
+		}
+	}
+	if r.Err != nil {
+		p.fail(DeadLetter[In]{Index: j.index, Input: j.in, Attempts: r.Attempts, Err: r.Err})
+	} else {
+		p.completed.Add(1)
+	}
+	return r, panicked
+}
+
+// sleep waits for d and reports whether the pool is still running.
+func (p *Pool[In, Out]) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+func (p *Pool[In, Out]) fail(d DeadLetter[In]) {
+	p.failed.Add(1)
+	p.deadMu.Lock()
+	p.dead = append(p.dead, d)
+	p.deadMu.Unlock()
+	if p.cfg.cancelOnError {
+		p.cancel(d.Err)
+	}
+}
+
+// reorder passes results on to p.results by index, buffering any that
+// arrive before their predecessors.
+func (p *Pool[In, Out]) reorder(in <-chan Result[Out]) {
+	defer close(p.done)
+	defer close(p.results)
+	pending := make(map[int]Result[Out])
+	next := 0
+	for r := range in {
+		pending[r.Index] = r
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			p.results <- r
+			next++
+		}
+	}
+}
+
+// Submit queues in for a worker and returns its index. It blocks while the
+// queue is full and fails with ErrClosed once Close has been called.
+func (p *Pool[In, Out]) Submit(in In) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, ErrClosed
+	}
+	index := p.next
+	p.next++
+	p.jobs <- job[In]{index: index, in: in}
+	return index, nil
+}
+
+// Results delivers one Result per submitted input and is closed after Close
+// once every job has finished.
+func (p *Pool[In, Out]) Results() <-chan Result[Out] {
+	return p.results
+}
+
+// Close stops accepting new inputs. Jobs already submitted still run.
+func (p *Pool[In, Out]) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+}
+
+// Wait blocks until the pool is closed, every job has finished and its
+// result has been handed to Results. It returns the error that cancelled the
+// pool, if any.
+func (p *Pool[In, Out]) Wait() error {
+	<-p.done
+	return p.err
+}
+
+func (p *Pool[In, Out]) Metrics() Metrics {
+	return Metrics{
+		Completed: p.completed.Load(),
+		Failed:    p.failed.Load(),
+		Panics:    p.panics.Load(),
+		Restarts:  p.restarts.Load(),
+	}
+}
+
+// DeadLetters returns the jobs that have failed for good so far, in the order
+// they failed.
+func (p *Pool[In, Out]) DeadLetters() []DeadLetter[In] {
+	p.deadMu.Lock()
+	defer p.deadMu.Unlock()
+	return append([]DeadLetter[In](nil), p.dead...)
+}
+
+// Map runs fn over inputs on a new pool and returns the results in input
+// order.
+func Map[In, Out any](inputs []In, fn func(In) (Out, error), opts ...Option) []Result[Out] {
+	p := New(fn, append(opts, WithOrderedResults())...)
+	go func() {
+		defer p.Close()
+		for _, in := range inputs {
+			p.Submit(in)
+		}
+	}()
+	results := make([]Result[Out], 0, len(inputs))
+	for r := range p.Results() {
+		results = append(results, r)
+	}
+	return results
+}
@@ -0,0 +1,132 @@
+package workerpool
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func double(n int) (int, error) {
+	return n * 2, nil
+}
+
+func TestPoolRunsEveryJob(t *testing.T) {
+	p := New(double, WithWorkers(3))
+	go func() {
+		defer p.Close()
+		for i := 0; i < 20; i++ {
+			_, err := p.Submit(i)
+			require.NoError(t, err)
+		}
+	}()
+
+	var got []int
+	for r := range p.Results() {
+		assert.NoError(t, r.Err)
+		assert.Equal(t, r.Index*2, r.Value)
+		got = append(got, r.Value)
+	}
+	p.Wait()
+	sort.Ints(got)
+	assert.Len(t, got, 20)
+	assert.Equal(t, 38, got[19])
+}
+
+func TestPoolOrdersResultsBySubmission(t *testing.T) {
+	// Earlier jobs sleep longer, so they finish last.
+	slow := func(n int) (int, error) {
+		time.Sleep(time.Duration(10-n) * time.Millisecond)
+		return n, nil
+	}
+	results := Map([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, slow, WithWorkers(5))
+	require.Len(t, results, 10)
+	for i, r := range results {
+		assert.Equal(t, i, r.Index)
+		assert.Equal(t, i, r.Value)
+	}
+}
+
+func TestPoolReportsPerJobErrors(t *testing.T) {
+	errOdd := errors.New("odd")
+	results := Map([]int{1, 2, 3, 4}, func(n int) (int, error) {
+		if n%2 == 1 {
+			return 0, errOdd
+		}
+		return n, nil
+	}, WithWorkers(2))
+
+	require.Len(t, results, 4)
+	assert.ErrorIs(t, results[0].Err, errOdd)
+	assert.NoError(t, results[1].Err)
+	assert.Equal(t, 2, results[1].Value)
+	assert.ErrorIs(t, results[2].Err, errOdd)
+}
+
+func TestPoolLimitsConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	Map(make([]int, 30), func(int) (int, error) {
+		n := running.Add(1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		return 0, nil
+	}, WithWorkers(4))
+	assert.LessOrEqual(t, peak.Load(), int32(4))
+	assert.Positive(t, peak.Load())
+}
+
+func TestPoolCloseIsGraceful(t *testing.T) {
+	p := New(double, WithWorkers(2), WithQueueSize(10))
+	for i := 0; i < 10; i++ {
+		_, err := p.Submit(i)
+		require.NoError(t, err)
+	}
+	p.Close()
+	p.Close()
+	_, err := p.Submit(10)
+	assert.ErrorIs(t, err, ErrClosed)
+
+	// Jobs queued before Close still run.
+	count := 0
+	for range p.Results() {
+		count++
+	}
+	p.Wait()
+	assert.Equal(t, 10, count)
+}
+
+func TestPoolConcurrentSubmitters(t *testing.T) {
+	p := New(double, WithWorkers(4), WithOrderedResults())
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				p.Submit(i)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		p.Close()
+	}()
+
+	next := 0
+	for r := range p.Results() {
+		assert.Equal(t, next, r.Index)
+		next++
+	}
+	assert.Equal(t, 100, next)
+}